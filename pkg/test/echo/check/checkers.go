@@ -126,6 +126,22 @@ func OK() Checker {
 	return NoErrorAndStatus(http.StatusOK)
 }
 
+// NotOK checks that the call succeeded and at least one response has a status code other than 200. Use
+// Or(Error(), NotOK()) to accept either a failed call or a denied request.
+func NotOK() Checker {
+	return func(rs echo.Responses, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, r := range rs {
+			if r.Code != strconv.Itoa(http.StatusOK) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected a response code other than 200, but all %d responses were 200", len(rs))
+	}
+}
+
 // NoErrorAndStatus is checks that no error occurred and htat the returned status code matches the expected
 // value.
 func NoErrorAndStatus(expected int) Checker {
@@ -273,6 +289,17 @@ func Cluster(expected string) Checker {
 	})
 }
 
+// PeerMetadata checks that the server received the given value for key in the peer metadata sent by the
+// requester's proxy.
+func PeerMetadata(key, expected string) Checker {
+	return Each(func(r echo.Response) error {
+		if actual, found := r.PeerMetadata[key]; !found || actual != expected {
+			return fmt.Errorf("expected peer metadata %s=%q, received %q", key, expected, actual)
+		}
+		return nil
+	})
+}
+
 func URL(expected string) Checker {
 	return Each(func(r echo.Response) error {
 		if r.URL != expected {
@@ -19,6 +19,7 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -37,6 +38,7 @@ var (
 	grpcPorts        []int
 	tcpPorts         []int
 	tlsPorts         []int
+	http3Ports       []int
 	instanceIPPorts  []int
 	localhostIPPorts []int
 	serverFirstPorts []int
@@ -49,6 +51,11 @@ var (
 	key              string
 	istioVersion     string
 	disableALPN      bool
+	pushResources    []string
+	errorRate        float64
+	delayPercentage  float64
+	delayDuration    time.Duration
+	connectProxy     bool
 
 	loggingOptions = log.DefaultOptions()
 
@@ -64,6 +71,10 @@ var (
 			for _, p := range tlsPorts {
 				tlsByPort[p] = true
 			}
+			http3ByPort := map[int]bool{}
+			for _, p := range http3Ports {
+				http3ByPort[p] = true
+			}
 			serverFirstByPort := map[int]bool{}
 			for _, p := range serverFirstPorts {
 				serverFirstByPort[p] = true
@@ -79,6 +90,7 @@ var (
 					Protocol:    protocol.HTTP,
 					Port:        p,
 					TLS:         tlsByPort[p],
+					HTTP3:       http3ByPort[p],
 					ServerFirst: serverFirstByPort[p],
 				}
 				portIndex++
@@ -125,6 +137,11 @@ var (
 				IstioVersion:          istioVersion,
 				UDSServer:             uds,
 				DisableALPN:           disableALPN,
+				PushResources:         pushResources,
+				ErrorRate:             errorRate,
+				DelayPercentage:       delayPercentage,
+				DelayDuration:         delayDuration,
+				ConnectProxy:          connectProxy,
 			})
 
 			if err := s.Start(); err != nil {
@@ -155,6 +172,7 @@ func init() {
 	rootCmd.PersistentFlags().IntSliceVar(&grpcPorts, "grpc", []int{7070}, "GRPC ports")
 	rootCmd.PersistentFlags().IntSliceVar(&tcpPorts, "tcp", []int{9090}, "TCP ports")
 	rootCmd.PersistentFlags().IntSliceVar(&tlsPorts, "tls", []int{}, "Ports that are using TLS. These must be defined as http/grpc/tcp.")
+	rootCmd.PersistentFlags().IntSliceVar(&http3Ports, "http3", []int{}, "Ports that also serve HTTP/3 over QUIC. These must be defined as http and tls.")
 	rootCmd.PersistentFlags().IntSliceVar(&instanceIPPorts, "bind-ip", []int{}, "Ports that are bound to INSTANCE_IP rather than wildcard IP.")
 	rootCmd.PersistentFlags().IntSliceVar(&localhostIPPorts, "bind-localhost", []int{}, "Ports that are bound to localhost rather than wildcard IP.")
 	rootCmd.PersistentFlags().IntSliceVar(&serverFirstPorts, "server-first", []int{}, "Ports that are server first. These must be defined as tcp.")
@@ -167,6 +185,17 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&key, "key", "", "gRPC TLS server-side key")
 	rootCmd.PersistentFlags().StringVar(&istioVersion, "istio-version", "", "Istio sidecar version")
 	rootCmd.PersistentFlags().BoolVar(&disableALPN, "disable-alpn", disableALPN, "disable ALPN negotiation")
+	rootCmd.PersistentFlags().StringSliceVar(&pushResources, "push-resources", []string{},
+		"Paths pushed to the client with HTTP/2 server push alongside every HTTP/2 response.")
+	rootCmd.PersistentFlags().Float64Var(&errorRate, "error-rate", 0,
+		"Fraction of HTTP requests that fail with a 503. Can be changed at runtime via /admin/error-rate?rate=<value> on the metrics port.")
+	rootCmd.PersistentFlags().Float64Var(&delayPercentage, "delay-percentage", 0,
+		"Percentage of HTTP requests that are delayed by --delay-duration. Can be changed at runtime via /admin/delay on the metrics port.")
+	rootCmd.PersistentFlags().DurationVar(&delayDuration, "delay-duration", 0,
+		"Delay applied to --delay-percentage of HTTP requests.")
+
+	rootCmd.PersistentFlags().BoolVar(&connectProxy, "connect-proxy", false,
+		"Accept HTTP CONNECT requests on HTTP ports and tunnel them to the requested host.")
 
 	loggingOptions.AttachCobraFlags(rootCmd)
 
@@ -57,6 +57,10 @@ type Port struct {
 	// ServerFirst if a port will be server first
 	ServerFirst bool
 
+	// HTTP3 determines if the port will additionally serve HTTP/3 over QUIC, on the same port number using UDP.
+	// Requires TLS.
+	HTTP3 bool
+
 	// InstanceIP determines if echo will listen on the instance IP, or wildcard
 	InstanceIP bool
 
@@ -37,4 +37,5 @@ const (
 	ClusterField        Field = "Cluster"
 	IstioVersionField   Field = "IstioVersion"
 	IPField             Field = "IP" // The Requester’s IP Address.
+	PeerMetadataField   Field = "PeerMetadata"
 )
@@ -38,6 +38,7 @@ var (
 	methodFieldRegex         = regexp.MustCompile(string(MethodField) + "=(.*)")
 	protocolFieldRegex       = regexp.MustCompile(string(ProtocolField) + "=(.*)")
 	alpnFieldRegex           = regexp.MustCompile(string(AlpnField) + "=(.*)")
+	peerMetadataFieldRegex   = regexp.MustCompile(string(PeerMetadataField) + "=(.*)")
 )
 
 func ParseResponses(req *proto.ForwardEchoRequest, resp *proto.ForwardEchoResponse) Responses {
@@ -54,6 +55,7 @@ func parseResponse(output string) Response {
 		RawContent:      output,
 		RequestHeaders:  make(http.Header),
 		ResponseHeaders: make(http.Header),
+		PeerMetadata:    make(map[string]string),
 	}
 
 	match := requestIDFieldRegex.FindStringSubmatch(output)
@@ -132,6 +134,15 @@ func parseResponse(output string) Response {
 		out.RequestHeaders.Set(sl[0], sl[1])
 	}
 
+	matches = peerMetadataFieldRegex.FindAllStringSubmatch(output, -1)
+	for _, kv := range matches {
+		sl := strings.SplitN(kv[1], ":", 2)
+		if len(sl) != 2 {
+			continue
+		}
+		out.PeerMetadata[sl[0]] = sl[1]
+	}
+
 	matches = responseHeaderFieldRegex.FindAllStringSubmatch(output, -1)
 	for _, kv := range matches {
 		sl := strings.SplitN(kv[1], ":", 2)
@@ -66,6 +66,8 @@ type Response struct {
 	rawBody         map[string]string
 	RequestHeaders  http.Header
 	ResponseHeaders http.Header
+	// PeerMetadata is the metadata that the requester's proxy sent in the X-Envoy-Peer-Metadata header, by key.
+	PeerMetadata map[string]string
 }
 
 // Count occurrences of the given text within the body of this response.
@@ -123,6 +125,7 @@ func (r Response) String() string {
 	out += fmt.Sprintf("IP:               %s\n", r.IP)
 	out += fmt.Sprintf("Request Headers:  %v\n", r.RequestHeaders)
 	out += fmt.Sprintf("Response Headers: %v\n", r.ResponseHeaders)
+	out += fmt.Sprintf("Peer Metadata:    %v\n", r.PeerMetadata)
 
 	return out
 }
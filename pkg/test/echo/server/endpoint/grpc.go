@@ -29,6 +29,7 @@ import (
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/admin"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	xdscreds "google.golang.org/grpc/credentials/xds"
@@ -37,6 +38,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/xds"
 	"k8s.io/utils/env"
 
@@ -284,6 +286,11 @@ func (h *EchoGrpcHandler) Echo(ctx context.Context, req *proto.EchoRequest) (*pr
 		writeField(&body, echo.HostnameField, hostname)
 	}
 
+	if code := codes.Code(req.GetGrpcStatusCode()); code != codes.OK {
+		epLog.WithLabels("id", id, "code", code).Infof("GRPC Response")
+		return nil, status.Errorf(code, "echo: requested status %v", code)
+	}
+
 	epLog.WithLabels("id", id).Infof("GRPC Response")
 	return &proto.EchoResponse{Message: body.String()}, nil
 }
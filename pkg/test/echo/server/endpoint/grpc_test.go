@@ -0,0 +1,123 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/echo/common"
+	"istio.io/istio/pkg/test/echo/proto"
+	"istio.io/istio/pkg/test/echo/server/endpoint"
+	"istio.io/istio/pkg/test/echo/server/forwarder"
+)
+
+// startEndpoint starts an endpoint for the given port on a random local port, and waits for it to be ready.
+// Like the echo server, the endpoint reports that the server is not ready until then.
+func startEndpoint(t *testing.T, cfg endpoint.Config) endpoint.Instance {
+	t.Helper()
+	var serverReady int32
+	cfg.IsServerReady = func() bool { return atomic.LoadInt32(&serverReady) == 1 }
+	cfg.ListenerIP = "127.0.0.1"
+	ep, err := endpoint.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan struct{})
+	if err := ep.Start(func() { close(ready) }); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ep.Close() })
+	<-ready
+	atomic.StoreInt32(&serverReady, 1)
+	return ep
+}
+
+func TestGRPCStatusCode(t *testing.T) {
+	ep := startEndpoint(t, endpoint.Config{
+		Port: &common.Port{Name: "grpc", Protocol: protocol.GRPC},
+	})
+	addr := fmt.Sprintf("127.0.0.1:%d", ep.GetConfig().Port.Port)
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	client := proto.NewEchoTestServiceClient(conn)
+
+	cases := []struct {
+		name string
+		code codes.Code
+	}{
+		{"ok", codes.OK},
+		{"unavailable", codes.Unavailable},
+		{"resource exhausted", codes.ResourceExhausted},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Echo(context.Background(), &proto.EchoRequest{Message: "hello", GrpcStatusCode: int32(tt.code)})
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("expected code %v from the server, got %v (%v)", tt.code, got, err)
+			}
+
+			// The forwarder, which CallOptions.GRPC.StatusCode is sent to, must pass the code on.
+			f, err := forwarder.New(forwarder.Config{
+				Request: &proto.ForwardEchoRequest{
+					Url:            "grpc://" + addr,
+					Count:          1,
+					GrpcStatusCode: int32(tt.code),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			_, err = f.Run(context.Background())
+			if tt.code == codes.OK {
+				if err != nil {
+					t.Fatalf("expected success, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected the call to fail with %v", tt.code)
+			}
+			if want := "code = " + tt.code.String(); !strings.Contains(err.Error(), want) {
+				t.Fatalf("expected %q in error, got %v", want, err)
+			}
+		})
+	}
+}
+
+func TestGRPCStatusCodeRequiresGRPC(t *testing.T) {
+	_, err := forwarder.New(forwarder.Config{
+		Request: &proto.ForwardEchoRequest{
+			Url:            "http://127.0.0.1:80",
+			GrpcStatusCode: int32(codes.Unavailable),
+		},
+	})
+	if err == nil {
+		t.Fatal("expected a gRPC status code to be rejected for HTTP")
+	}
+}
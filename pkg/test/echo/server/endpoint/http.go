@@ -19,6 +19,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"net/http"
@@ -30,6 +31,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/lucas-clemente/quic-go/http3"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 
@@ -41,6 +43,10 @@ import (
 const (
 	readyTimeout  = 10 * time.Second
 	readyInterval = 2 * time.Second
+
+	connectDialTimeout = 5 * time.Second
+
+	sseInterval = 100 * time.Millisecond
 )
 
 var webSocketUpgrader = websocket.Upgrader{
@@ -54,7 +60,8 @@ var _ Instance = &httpInstance{}
 
 type httpInstance struct {
 	Config
-	server *http.Server
+	server      *http.Server
+	http3Server *http3.Server
 }
 
 func newHTTP(config Config) Instance {
@@ -68,11 +75,16 @@ func (s *httpInstance) GetConfig() Config {
 }
 
 func (s *httpInstance) Start(onReady OnReadyFunc) error {
+	if s.Port != nil && s.Port.HTTP3 && !s.Port.TLS {
+		return fmt.Errorf("http3 requires TLS on port %d", s.Port.Port)
+	}
+
+	handler := &httpHandler{
+		Config: s.Config,
+	}
 	h2s := &http2.Server{}
 	s.server = &http.Server{
-		Handler: h2c.NewHandler(&httpHandler{
-			Config: s.Config,
-		}, h2s),
+		Handler: h2c.NewHandler(handler, h2s),
 	}
 
 	var listener net.Listener
@@ -105,6 +117,11 @@ func (s *httpInstance) Start(onReady OnReadyFunc) error {
 		listener, port, err = listenOnAddressTLS(s.ListenerIP, s.Port.Port, config)
 		// Store the actual listening port back to the argument.
 		s.Port.Port = port
+		if err == nil && s.Port.HTTP3 {
+			if err = s.startHTTP3(handler, config, port); err != nil {
+				_ = listener.Close()
+			}
+		}
 	} else {
 		// Listen on the given port and update the port if it changed from what was passed in.
 		listener, port, err = listenOnAddress(s.ListenerIP, s.Port.Port)
@@ -138,6 +155,26 @@ func (s *httpInstance) Start(onReady OnReadyFunc) error {
 	return nil
 }
 
+// startHTTP3 serves HTTP/3 over QUIC on the given UDP port, alongside the TCP listener.
+func (s *httpInstance) startHTTP3(handler http.Handler, config *tls.Config, port int) error {
+	conn, err := listenOnAddressUDP(s.ListenerIP, port)
+	if err != nil {
+		return err
+	}
+	s.http3Server = &http3.Server{
+		Server: &http.Server{
+			Handler:   handler,
+			TLSConfig: config,
+		},
+	}
+	fmt.Printf("Listening HTTP/3 on %v\n", port)
+	go func() {
+		err := s.http3Server.Serve(conn)
+		epLog.Warnf("Port %d HTTP/3 listener terminated with error: %v", port, err)
+	}()
+	return nil
+}
+
 func (s *httpInstance) isUDS() bool {
 	return s.UDSServer != ""
 }
@@ -187,6 +224,9 @@ func (s *httpInstance) awaitReady(onReady OnReadyFunc, address string) {
 }
 
 func (s *httpInstance) Close() error {
+	if s.http3Server != nil {
+		_ = s.http3Server.Close()
+	}
 	if s.server != nil {
 		return s.server.Close()
 	}
@@ -219,14 +259,147 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
+	if h.InjectError != nil && h.InjectError() {
+		epLog.Infof("Injecting error, returning 503")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if h.InjectDelay != nil {
+		if d := h.InjectDelay(); d > 0 {
+			epLog.Infof("Injecting delay of %v", d)
+			time.Sleep(d)
+		}
+	}
 
-	if common.IsWebSocketRequest(r) {
+	if h.ConnectProxy && r.Method == http.MethodConnect {
+		h.connectProxy(w, r)
+	} else if common.IsWebSocketRequest(r) {
 		h.webSocketEcho(w, r)
+	} else if r.URL.Path == "/sse" {
+		h.serverSentEvents(w, r)
 	} else {
+		h.pushResources(w, r)
 		h.echo(w, r, id)
 	}
 }
 
+// pushResources sends a push promise for each of the configured PushResources, if the client supports HTTP/2
+// server push.
+func (h *httpHandler) pushResources(w http.ResponseWriter, r *http.Request) {
+	if len(h.PushResources) == 0 || r.ProtoMajor != 2 {
+		return
+	}
+	pusher, ok := w.(http.Pusher)
+	if !ok {
+		return
+	}
+	for _, target := range h.PushResources {
+		if target == r.URL.Path {
+			// Don't push the resource that was requested.
+			continue
+		}
+		if err := pusher.Push(target, nil); err != nil {
+			epLog.Debugf("failed to push %s: %v", target, err)
+		}
+	}
+}
+
+// serverSentEvents streams an event every sseInterval until the client disconnects. Each event carries the usual
+// echo response fields, along with its sequence number as the event ID.
+func (h *httpHandler) serverSentEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		epLog.Warnf("SSE over %s is not supported", r.Proto)
+		w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseInterval)
+	defer ticker.Stop()
+	for id := 0; ; id++ {
+		select {
+		case <-r.Context().Done():
+			epLog.Infof("SSE stream closed after %d events", id)
+			return
+		case <-ticker.C:
+		}
+		body := bytes.Buffer{}
+		h.addResponsePayload(r, &body)
+		writeField(&body, echo.StatusCodeField, strconv.Itoa(http.StatusOK))
+		event := bytes.Buffer{}
+		event.WriteString("id: " + strconv.Itoa(id) + "\n")
+		for _, line := range strings.Split(strings.TrimSuffix(body.String(), "\n"), "\n") {
+			event.WriteString("data: " + line + "\n")
+		}
+		event.WriteString("\n")
+		if _, err := w.Write(event.Bytes()); err != nil {
+			epLog.Infof("SSE stream closed after %d events: %v", id, err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// connectProxy tunnels the connection to the host of the CONNECT request. Only HTTP/1.x CONNECT is supported, since
+// the connection is taken over from the HTTP server.
+func (h *httpHandler) connectProxy(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		epLog.Warnf("CONNECT to %s over %s is not supported", r.Host, r.Proto)
+		w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), connectDialTimeout)
+	defer cancel()
+	upstream, err := h.Dialer.TCP(net.Dialer{}, ctx, r.Host)
+	if err != nil {
+		epLog.Warnf("CONNECT to %s failed: %v", r.Host, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		epLog.Warnf("CONNECT to %s failed to hijack connection: %v", r.Host, err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		epLog.Warnf("CONNECT to %s failed to respond: %v", r.Host, err)
+		return
+	}
+	epLog.Infof("CONNECT tunnel established to %s", r.Host)
+
+	// Copy in both directions until each side is done sending, half-closing the other side as each finishes so
+	// that data still in flight in the other direction is not cut off.
+	done := make(chan struct{}, 2)
+	go func() {
+		// Forward anything the client sent along with the CONNECT request.
+		_, _ = io.Copy(upstream, buf)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		closeWrite(conn)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// closeWrite shuts down the writing side of conn if it supports it, as TCP connections do.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+}
+
 // nolint: interfacer
 func writeError(out *bytes.Buffer, msg string) {
 	epLog.Warn(msg)
@@ -339,6 +512,7 @@ func (h *httpHandler) addResponsePayload(r *http.Request, body *bytes.Buffer) {
 			writeRequestHeader(body, key, value)
 		}
 	}
+	writePeerMetadata(body, r.Header.Get(peerMetadataHeader))
 
 	if hostname, err := os.Hostname(); err == nil {
 		writeField(body, echo.HostnameField, hostname)
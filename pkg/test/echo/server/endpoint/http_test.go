@@ -0,0 +1,167 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/echo"
+	"istio.io/istio/pkg/test/echo/common"
+	"istio.io/istio/pkg/test/echo/server/endpoint"
+)
+
+func startHTTPEndpoint(t *testing.T, cfg endpoint.Config) string {
+	t.Helper()
+	cfg.Dialer = common.Dialer{}.FillInDefaults()
+	cfg.Port = &common.Port{Name: "http", Protocol: protocol.HTTP}
+	ep := startEndpoint(t, cfg)
+	return fmt.Sprintf("127.0.0.1:%d", ep.GetConfig().Port.Port)
+}
+
+func TestConnectProxy(t *testing.T) {
+	// The upstream only replies once the client is done sending, so the tunnel must carry data back after the
+	// client half-closes it.
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = upstream.Close() }()
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		got, _ := io.ReadAll(conn)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = conn.Write(append([]byte("got: "), got...))
+	}()
+
+	addr := startHTTPEndpoint(t, endpoint.Config{ConnectProxy: true})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	target := upstream.Addr().String()
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected CONNECT to succeed, got %v", resp.Status)
+	}
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "got: hello" {
+		t.Fatalf("unexpected data through the tunnel: %q", got)
+	}
+}
+
+func TestConnectProxyDisabled(t *testing.T) {
+	addr := startHTTPEndpoint(t, endpoint.Config{})
+	req, err := http.NewRequest(http.MethodConnect, "http://"+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "127.0.0.1:1"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	// Without ConnectProxy, CONNECT is handled like any other request and echoed back.
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the request to be echoed, got %v", resp.Status)
+	}
+}
+
+func TestServerSentEvents(t *testing.T) {
+	addr := startHTTPEndpoint(t, endpoint.Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/sse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the stream to open, got %v", resp.Status)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("expected Content-Type text/event-stream, got %q", got)
+	}
+
+	// Each event is an id line followed by the echo response as data lines, and ends with a blank line.
+	br := bufio.NewReader(resp.Body)
+	for id := 0; id < 3; id++ {
+		var lines []string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("event %d: %v", id, err)
+			}
+			if line == "\n" {
+				break
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) < 2 {
+			t.Fatalf("event %d: expected data lines, got %q", id, lines)
+		}
+		if want := "id: " + strconv.Itoa(id) + "\n"; lines[0] != want {
+			t.Fatalf("event %d: expected %q, got %q", id, want, lines[0])
+		}
+		data := ""
+		for _, line := range lines[1:] {
+			if !strings.HasPrefix(line, "data: ") {
+				t.Fatalf("event %d: expected a data line, got %q", id, line)
+			}
+			data += strings.TrimPrefix(line, "data: ")
+		}
+		if want := string(echo.StatusCodeField) + "=200\n"; !strings.Contains(data, want) {
+			t.Fatalf("event %d: expected %q in data, got %q", id, want, data)
+		}
+	}
+}
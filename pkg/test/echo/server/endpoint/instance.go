@@ -17,6 +17,7 @@ package endpoint
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/test/echo/common"
@@ -25,12 +26,20 @@ import (
 // IsServerReadyFunc is a function that indicates whether the server is currently ready to handle traffic.
 type IsServerReadyFunc func() bool
 
+// InjectErrorFunc is a function that indicates whether the current request should fail with an injected error.
+type InjectErrorFunc func() bool
+
+// InjectDelayFunc is a function that returns the delay to inject before responding to the current request.
+type InjectDelayFunc func() time.Duration
+
 // OnReadyFunc is a callback function that informs the server that the endpoint is ready.
 type OnReadyFunc func()
 
 // Config for a single endpoint Instance.
 type Config struct {
 	IsServerReady IsServerReadyFunc
+	InjectError   InjectErrorFunc
+	InjectDelay   InjectDelayFunc
 	Version       string
 	Cluster       string
 	TLSCert       string
@@ -41,6 +50,8 @@ type Config struct {
 	ListenerIP    string
 	IstioVersion  string
 	DisableALPN   bool
+	PushResources []string
+	ConnectProxy  bool
 }
 
 // Instance of an endpoint that serves the Echo application on a single port/protocol.
@@ -17,16 +17,25 @@ package endpoint
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
 	"istio.io/istio/pkg/test/echo"
 	"istio.io/pkg/log"
 )
 
 var epLog = log.RegisterScope("endpoint", "echo serverside", 0)
 
+// peerMetadataHeader is the header in which Envoy's metadata exchange sends the peer's metadata.
+const peerMetadataHeader = "X-Envoy-Peer-Metadata"
+
 func listenOnAddress(ip string, port int) (net.Listener, int, error) {
 	parsedIP := net.ParseIP(ip)
 	ipBind := "tcp"
@@ -64,6 +73,19 @@ func listenOnAddressTLS(ip string, port int, cfg *tls.Config) (net.Listener, int
 	return ln, port, nil
 }
 
+func listenOnAddressUDP(ip string, port int) (net.PacketConn, error) {
+	ipBind := "udp"
+	parsedIP := net.ParseIP(ip)
+	if parsedIP != nil {
+		if parsedIP.To4() == nil && parsedIP.To16() != nil {
+			ipBind = "udp6"
+		} else if parsedIP.To4() != nil {
+			ipBind = "udp4"
+		}
+	}
+	return net.ListenPacket(ipBind, net.JoinHostPort(ip, strconv.Itoa(port)))
+}
+
 func listenOnUDS(uds string) (net.Listener, error) {
 	_ = os.Remove(uds)
 	ln, err := net.Listen("unix", uds)
@@ -83,3 +105,39 @@ func writeField(out *bytes.Buffer, field echo.Field, value string) {
 func writeRequestHeader(out *bytes.Buffer, key, value string) {
 	writeField(out, echo.RequestHeaderField, key+":"+value)
 }
+
+// writePeerMetadata decodes the peer metadata that Envoy sends in the X-Envoy-Peer-Metadata header, a base64
+// encoded google.protobuf.Struct, and writes a field for each of its top-level keys. Values that are not strings
+// (such as LABELS) are written as JSON.
+func writePeerMetadata(out *bytes.Buffer, header string) {
+	if header == "" {
+		return
+	}
+	b, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		epLog.Warnf("failed decoding %s header: %v", peerMetadataHeader, err)
+		return
+	}
+	md := &structpb.Struct{}
+	if err := proto.Unmarshal(b, md); err != nil {
+		epLog.Warnf("failed unmarshaling %s header: %v", peerMetadataHeader, err)
+		return
+	}
+	keys := make([]string, 0, len(md.Fields))
+	for k := range md.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := md.Fields[k]
+		value := v.GetStringValue()
+		if _, isString := v.Kind.(*structpb.Value_StringValue); !isString {
+			j, err := json.Marshal(v.AsInterface())
+			if err != nil {
+				continue
+			}
+			value = string(j)
+		}
+		writeField(out, echo.PeerMetadataField, k+":"+value)
+	}
+}
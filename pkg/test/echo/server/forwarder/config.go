@@ -62,6 +62,25 @@ func (c *Config) fillDefaults() error {
 		return fmt.Errorf("missing protocol scheme in the request URL: %s", c.Request.Url)
 	}
 
+	switch c.Request.ProxyProtocolVersion {
+	case 0, 1, 2:
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version: %d", c.Request.ProxyProtocolVersion)
+	}
+	if c.Request.ProxyProtocolVersion != 0 {
+		switch {
+		case c.scheme != scheme.HTTP && c.scheme != scheme.HTTPS && c.scheme != scheme.TCP:
+			return fmt.Errorf("PROXY protocol is not supported for scheme %s", c.scheme)
+		case c.Request.Http3:
+			return fmt.Errorf("PROXY protocol is not supported for HTTP/3")
+		case len(c.UDS) > 0:
+			return fmt.Errorf("PROXY protocol is not supported over unix domain sockets")
+		}
+	}
+	if c.Request.GrpcStatusCode != 0 && c.scheme != scheme.GRPC && c.scheme != scheme.XDS {
+		return fmt.Errorf("gRPC status code %d requested for non-gRPC scheme %s", c.Request.GrpcStatusCode, c.scheme)
+	}
+
 	var err error
 	c.getClientCertificate, err = getClientCertificateFunc(c.Request)
 	if err != nil {
@@ -98,7 +98,8 @@ func makeGRPCRequest(ctx context.Context, conn *grpc.ClientConn, req *request) (
 
 	var outBuffer bytes.Buffer
 	grpcReq := &proto.EchoRequest{
-		Message: req.Message,
+		Message:        req.Message,
+		GrpcStatusCode: req.GRPCStatusCode,
 	}
 	outBuffer.WriteString(fmt.Sprintf("[%d] grpcecho.Echo(%v)\n", req.RequestID, req))
 
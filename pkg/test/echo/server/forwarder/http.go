@@ -93,7 +93,7 @@ func (c *httpProtocol) newClient() (*http.Client, error) {
 			client.Transport = &http2.Transport{
 				TLSClientConfig: c.tlsConfig,
 				DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-					return tls.DialWithDialer(newDialer(), network, addr, cfg)
+					return c.dialTLS(context.Background(), network, addr, cfg)
 				},
 			}
 		} else {
@@ -104,13 +104,13 @@ func (c *httpProtocol) newClient() (*http.Client, error) {
 				AllowHTTP: true,
 				// Pretend we are dialing a TLS endpoint. (Note, we ignore the passed tls.Config)
 				DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-					return newDialer().Dial(network, addr)
+					return c.dial(context.Background(), network, addr)
 				},
 			}
 		}
 	default:
 		dialContext := func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return newDialer().Dial(network, addr)
+			return c.dial(context.Background(), network, addr)
 		}
 		if len(c.UDS) > 0 {
 			dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
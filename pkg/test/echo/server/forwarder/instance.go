@@ -46,6 +46,8 @@ type Instance struct {
 	// Method for the request. Only valid for HTTP
 	method           string
 	expectedResponse *wrappers.StringValue
+	// gRPC status code the server is asked to respond with. Only valid for gRPC
+	grpcStatusCode int32
 }
 
 // New creates a new forwarder Instance.
@@ -70,6 +72,7 @@ func New(cfg Config) (*Instance, error) {
 		header:           cfg.headers,
 		message:          cfg.Request.Message,
 		expectedResponse: cfg.Request.ExpectedResponse,
+		grpcStatusCode:   cfg.Request.GrpcStatusCode,
 	}, nil
 }
 
@@ -106,6 +109,7 @@ func (i *Instance) Run(ctx context.Context) (*proto.ForwardEchoResponse, error)
 			Timeout:          i.timeout,
 			ServerFirst:      i.serverFirst,
 			Method:           i.method,
+			GRPCStatusCode:   i.grpcStatusCode,
 		}
 
 		if throttle != nil {
@@ -36,6 +36,7 @@ type request struct {
 	Timeout          time.Duration
 	ServerFirst      bool
 	Method           string
+	GRPCStatusCode   int32
 }
 
 type protocol interface {
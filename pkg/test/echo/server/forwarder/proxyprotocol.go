@@ -0,0 +1,125 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// proxyProtocolV2Signature is the fixed prefix of every PROXY protocol v2 header.
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// dial connects to addr and, if the request asked for it, writes a PROXY protocol header
+// before returning the connection.
+func (c *Config) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := newDialer().DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if v := c.Request.ProxyProtocolVersion; v != 0 {
+		if err := writeProxyProtocolHeader(conn, v); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// dialTLS is like dial, but performs a TLS handshake after the PROXY protocol header is written.
+func (c *Config) dialTLS(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+	if c.Request.ProxyProtocolVersion == 0 {
+		return tls.DialWithDialer(newDialer(), network, addr, cfg)
+	}
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ServerName == "" {
+		// Mirror tls.Dial, which infers the server name from the address.
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// writeProxyProtocolHeader writes a PROXY protocol header of the given version to conn. The
+// connection's own local and remote addresses are advertised as the source and destination.
+func writeProxyProtocolHeader(conn net.Conn, version int32) error {
+	src, ok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("PROXY protocol requires a TCP connection, got %s", conn.LocalAddr().Network())
+	}
+	dst, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("PROXY protocol requires a TCP connection, got %s", conn.RemoteAddr().Network())
+	}
+	header, err := proxyProtocolHeader(version, src, dst)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(header)
+	return err
+}
+
+// proxyProtocolHeader returns the PROXY protocol header of the given version for a TCP connection
+// from src to dst. If either address is IPv6, both are advertised as IPv6.
+func proxyProtocolHeader(version int32, src, dst *net.TCPAddr) ([]byte, error) {
+	srcIP, dstIP, family := src.IP.To4(), dst.IP.To4(), "TCP4"
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP, family = src.IP.To16(), dst.IP.To16(), "TCP6"
+	}
+	if srcIP == nil || dstIP == nil {
+		return nil, fmt.Errorf("invalid PROXY protocol addresses %v and %v", src, dst)
+	}
+
+	var header []byte
+	switch version {
+	case 1:
+		header = []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, srcIP, dstIP, src.Port, dst.Port))
+	case 2:
+		// Version 2 with the PROXY command, then the address family over a stream transport.
+		header = append(header, proxyProtocolV2Signature...)
+		header = append(header, 0x21)
+		if family == "TCP4" {
+			header = append(header, 0x11)
+		} else {
+			header = append(header, 0x21)
+		}
+		addrs := make([]byte, 2*len(srcIP)+4)
+		copy(addrs, srcIP)
+		copy(addrs[len(srcIP):], dstIP)
+		binary.BigEndian.PutUint16(addrs[2*len(srcIP):], uint16(src.Port))
+		binary.BigEndian.PutUint16(addrs[2*len(srcIP)+2:], uint16(dst.Port))
+		header = append(header, byte(len(addrs)>>8), byte(len(addrs)))
+		header = append(header, addrs...)
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %d", version)
+	}
+	return header, nil
+}
@@ -0,0 +1,121 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwarder
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"istio.io/istio/pkg/test/echo/proto"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	v4src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+	v4dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80}
+	v6src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}
+	v6dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+	v2 := func(b ...byte) []byte {
+		return append([]byte("\r\n\r\n\x00\r\nQUIT\n"), b...)
+	}
+
+	cases := []struct {
+		name     string
+		version  int32
+		src, dst *net.TCPAddr
+		want     []byte
+	}{
+		{
+			name:    "v1 ipv4",
+			version: 1,
+			src:     v4src,
+			dst:     v4dst,
+			want:    []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1234 80\r\n"),
+		},
+		{
+			name:    "v1 ipv6",
+			version: 1,
+			src:     v6src,
+			dst:     v6dst,
+			want:    []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1234 443\r\n"),
+		},
+		{
+			name:    "v2 ipv4",
+			version: 2,
+			src:     v4src,
+			dst:     v4dst,
+			want: v2(
+				0x21, 0x11, 0x00, 0x0c,
+				10, 0, 0, 1,
+				10, 0, 0, 2,
+				0x04, 0xd2, 0x00, 0x50,
+			),
+		},
+		{
+			name:    "v2 ipv6",
+			version: 2,
+			src:     v6src,
+			dst:     v6dst,
+			want: v2(
+				0x21, 0x21, 0x00, 0x24,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02,
+				0x04, 0xd2, 0x01, 0xbb,
+			),
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := proxyProtocolHeader(tt.version, tt.src, tt.dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := proxyProtocolHeader(3, v4src, v4dst); err == nil {
+		t.Fatal("expected an error for an unsupported version")
+	}
+}
+
+func TestWriteProxyProtocolHeaderNonTCP(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+	if err := writeProxyProtocolHeader(client, 1); err == nil {
+		t.Fatal("expected an error for a non-TCP connection")
+	}
+}
+
+func TestProxyProtocolUnsupportedScheme(t *testing.T) {
+	cases := []*proto.ForwardEchoRequest{
+		{Url: "grpc://127.0.0.1:80", ProxyProtocolVersion: 1},
+		{Url: "ws://127.0.0.1:80", ProxyProtocolVersion: 1},
+		{Url: "https://127.0.0.1:443", ProxyProtocolVersion: 2, Http3: true},
+	}
+	for _, req := range cases {
+		cfg := Config{Request: req}
+		if err := cfg.fillDefaults(); err == nil {
+			t.Errorf("expected %s with PROXY protocol to be rejected", req.Url)
+		}
+	}
+	cfg := Config{Request: &proto.ForwardEchoRequest{Url: "tcp://127.0.0.1:80", ProxyProtocolVersion: 2}}
+	if err := cfg.fillDefaults(); err != nil {
+		t.Fatal(err)
+	}
+}
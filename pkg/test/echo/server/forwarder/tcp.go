@@ -18,7 +18,6 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -42,12 +41,12 @@ func newTCPProtocol(r *Config) (protocol, error) {
 		conn: func() (net.Conn, error) {
 			address := r.Request.Url[len(r.scheme+"://"):]
 
+			ctx, cancel := context.WithTimeout(context.Background(), common.ConnectionTimeout)
+			defer cancel()
 			if r.getClientCertificate == nil {
-				ctx, cancel := context.WithTimeout(context.Background(), common.ConnectionTimeout)
-				defer cancel()
-				return newDialer().DialContext(ctx, "tcp", address)
+				return r.dial(ctx, "tcp", address)
 			}
-			return tls.DialWithDialer(newDialer(), "tcp", address, r.tlsConfig)
+			return r.dialTLS(ctx, "tcp", address, r.tlsConfig)
 		},
 	}, nil
 }
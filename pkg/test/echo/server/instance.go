@@ -16,14 +16,18 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	ocprom "contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/hashicorp/go-multierror"
@@ -51,6 +55,17 @@ type Config struct {
 	Dialer                common.Dialer
 	IstioVersion          string
 	DisableALPN           bool
+	PushResources         []string
+	// ErrorRate is the fraction of HTTP requests, between 0 and 1, that fail with a 503. It can be changed at
+	// runtime through the /admin/error-rate endpoint of the metrics server.
+	ErrorRate float64
+	// DelayPercentage is the percentage of HTTP requests, between 0 and 100, that are delayed by DelayDuration
+	// before they are handled. Both can be changed at runtime through the /admin/delay endpoint of the metrics
+	// server.
+	DelayPercentage float64
+	DelayDuration   time.Duration
+	// ConnectProxy makes the HTTP ports accept CONNECT requests and tunnel them to the requested host.
+	ConnectProxy bool
 }
 
 func (c Config) String() string {
@@ -65,6 +80,11 @@ func (c Config) String() string {
 	b.WriteString(fmt.Sprintf("UDSServer:             %v\n", c.UDSServer))
 	b.WriteString(fmt.Sprintf("Cluster:               %v\n", c.Cluster))
 	b.WriteString(fmt.Sprintf("IstioVersion:          %v\n", c.IstioVersion))
+	b.WriteString(fmt.Sprintf("PushResources:         %v\n", c.PushResources))
+	b.WriteString(fmt.Sprintf("ErrorRate:             %v\n", c.ErrorRate))
+	b.WriteString(fmt.Sprintf("DelayPercentage:       %v\n", c.DelayPercentage))
+	b.WriteString(fmt.Sprintf("DelayDuration:         %v\n", c.DelayDuration))
+	b.WriteString(fmt.Sprintf("ConnectProxy:          %v\n", c.ConnectProxy))
 
 	return b.String()
 }
@@ -78,6 +98,26 @@ type Instance struct {
 	endpoints     []endpoint.Instance
 	metricsServer *http.Server
 	ready         uint32
+	// errorRate holds the bits of the current error rate, see math.Float64bits.
+	errorRate uint64
+	requests  uint64
+
+	delayMu sync.RWMutex
+	delay   delay
+	delayed uint64
+}
+
+// DelayConfig is the body of requests to the /admin/delay endpoint of the metrics server.
+type DelayConfig struct {
+	// Percentage of HTTP requests, between 0 and 100, to delay.
+	Percentage float64 `json:"percentage"`
+	// Duration of the delay, e.g. "200ms".
+	Duration string `json:"duration"`
+}
+
+type delay struct {
+	fraction float64
+	duration time.Duration
 }
 
 // New creates a new server instance.
@@ -86,7 +126,8 @@ func New(config Config) *Instance {
 	config.Dialer = config.Dialer.FillInDefaults()
 
 	return &Instance{
-		Config: config,
+		Config:    config,
+		errorRate: math.Float64bits(config.ErrorRate),
 	}
 }
 
@@ -102,6 +143,12 @@ func (s *Instance) Start() (err error) {
 		return err
 	}
 
+	if err = validateErrorRate(s.ErrorRate); err != nil {
+		return err
+	}
+	if err = s.SetDelay(s.DelayPercentage, s.DelayDuration); err != nil {
+		return err
+	}
 	if s.Metrics > 0 {
 		go s.startMetricsServer()
 	}
@@ -207,6 +254,8 @@ func (s *Instance) newEndpoint(port *common.Port, listenerIP string, udsServer s
 		Port:          port,
 		UDSServer:     udsServer,
 		IsServerReady: s.isReady,
+		InjectError:   s.injectError,
+		InjectDelay:   s.injectDelay,
 		Version:       s.Version,
 		Cluster:       s.Cluster,
 		TLSCert:       s.TLSCert,
@@ -215,6 +264,8 @@ func (s *Instance) newEndpoint(port *common.Port, listenerIP string, udsServer s
 		ListenerIP:    listenerIP,
 		DisableALPN:   s.DisableALPN,
 		IstioVersion:  s.IstioVersion,
+		PushResources: s.PushResources,
+		ConnectProxy:  s.ConnectProxy,
 	})
 }
 
@@ -222,6 +273,109 @@ func (s *Instance) isReady() bool {
 	return atomic.LoadUint32(&s.ready) == 1
 }
 
+// injectError returns true if the current request should fail. Failures are spread evenly across requests, so that
+// exactly ErrorRate of any run of requests fail, rather than being left to chance.
+func (s *Instance) injectError() bool {
+	rate := math.Float64frombits(atomic.LoadUint64(&s.errorRate))
+	if rate <= 0 {
+		return false
+	}
+	return spreadEvenly(&s.requests, rate)
+}
+
+// spreadEvenly increments the counter and returns true for the given fraction of calls, spread evenly across them.
+func spreadEvenly(counter *uint64, fraction float64) bool {
+	n := atomic.AddUint64(counter, 1)
+	return uint64(float64(n)*fraction) != uint64(float64(n-1)*fraction)
+}
+
+// SetErrorRate changes the fraction of HTTP requests that fail with a 503.
+func (s *Instance) SetErrorRate(rate float64) error {
+	if err := validateErrorRate(rate); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&s.errorRate, math.Float64bits(rate))
+	return nil
+}
+
+func validateErrorRate(rate float64) error {
+	if rate < 0 || rate > 1 || math.IsNaN(rate) {
+		return fmt.Errorf("error rate must be between 0 and 1, got %v", rate)
+	}
+	return nil
+}
+
+// handleErrorRate returns the current error rate, or changes it if the request has the form ?rate=[:value].
+func (s *Instance) handleErrorRate(w http.ResponseWriter, r *http.Request) {
+	if v := r.URL.Query().Get("rate"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			err = s.SetErrorRate(rate)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infof("Error rate set to %v", rate)
+	}
+	_, _ = fmt.Fprintf(w, "%v\n", math.Float64frombits(atomic.LoadUint64(&s.errorRate)))
+}
+
+// injectDelay returns the delay to inject before responding to the current request. Delays are spread evenly
+// across requests, in the same way as errors.
+func (s *Instance) injectDelay() time.Duration {
+	s.delayMu.RLock()
+	d := s.delay
+	s.delayMu.RUnlock()
+	if d.fraction <= 0 || d.duration <= 0 || !spreadEvenly(&s.delayed, d.fraction) {
+		return 0
+	}
+	return d.duration
+}
+
+// SetDelay delays the given percentage of HTTP requests by the given duration before they are handled.
+func (s *Instance) SetDelay(percentage float64, duration time.Duration) error {
+	if percentage < 0 || percentage > 100 || math.IsNaN(percentage) {
+		return fmt.Errorf("delay percentage must be between 0 and 100, got %v", percentage)
+	}
+	if duration < 0 {
+		return fmt.Errorf("delay duration must not be negative, got %v", duration)
+	}
+	s.delayMu.Lock()
+	defer s.delayMu.Unlock()
+	s.delay = delay{fraction: percentage / 100, duration: duration}
+	return nil
+}
+
+// handleDelay returns the current delay configuration, or changes it if the request has a DelayConfig body.
+func (s *Instance) handleDelay(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		cfg := DelayConfig{}
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, fmt.Sprintf("invalid delay config: %v", err), http.StatusBadRequest)
+			return
+		}
+		var duration time.Duration
+		if cfg.Duration != "" {
+			var err error
+			if duration, err = time.ParseDuration(cfg.Duration); err != nil {
+				http.Error(w, fmt.Sprintf("invalid delay duration: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.SetDelay(cfg.Percentage, duration); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infof("Delay set to %v for %v%% of requests", duration, cfg.Percentage)
+	}
+	s.delayMu.RLock()
+	d := s.delay
+	s.delayMu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(DelayConfig{Percentage: d.fraction * 100, Duration: d.duration.String()})
+}
+
 func (s *Instance) waitUntilReady() error {
 	wg := &sync.WaitGroup{}
 
@@ -272,6 +426,8 @@ func (s *Instance) startMetricsServer() {
 	}
 	view.RegisterExporter(exporter)
 	mux.Handle("/metrics", exporter)
+	mux.HandleFunc("/admin/error-rate", s.handleErrorRate)
+	mux.HandleFunc("/admin/delay", s.handleDelay)
 	s.metricsServer = &http.Server{
 		Handler: mux,
 	}
@@ -0,0 +1,217 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/echo/common"
+)
+
+// startServer starts an echo server with a single HTTP port, and returns its URL.
+func startServer(t *testing.T, cfg Config) (*Instance, string) {
+	t.Helper()
+	port := &common.Port{Name: "http", Protocol: protocol.HTTP}
+	cfg.Ports = common.PortList{port}
+	s := New(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, fmt.Sprintf("http://127.0.0.1:%d", port.Port)
+}
+
+// statusCodes makes n requests to url and returns the number of responses with each status code.
+func statusCodes(t *testing.T, url string, n int) map[int]int {
+	t.Helper()
+	out := map[int]int{}
+	for i := 0; i < n; i++ {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		out[resp.StatusCode]++
+	}
+	return out
+}
+
+func TestErrorRate(t *testing.T) {
+	cases := []struct {
+		rate float64
+		want map[int]int
+	}{
+		{0, map[int]int{http.StatusOK: 10}},
+		{0.5, map[int]int{http.StatusOK: 5, http.StatusServiceUnavailable: 5}},
+		{1, map[int]int{http.StatusServiceUnavailable: 10}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprint(tt.rate), func(t *testing.T) {
+			_, url := startServer(t, Config{ErrorRate: tt.rate})
+			got := statusCodes(t, url, 10)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("expected status codes %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestErrorRateInvalid(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.1, math.NaN()} {
+		s := New(Config{ErrorRate: rate})
+		if err := s.Start(); err == nil {
+			t.Errorf("expected error rate %v to be rejected", rate)
+		}
+		if err := s.SetErrorRate(rate); err == nil {
+			t.Errorf("expected SetErrorRate(%v) to be rejected", rate)
+		}
+	}
+}
+
+func TestHandleErrorRate(t *testing.T) {
+	s, url := startServer(t, Config{})
+	admin := func(query string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleErrorRate(w, httptest.NewRequest(http.MethodGet, "/admin/error-rate"+query, nil))
+		return w.Code
+	}
+	if code := admin("?rate=1"); code != http.StatusOK {
+		t.Fatalf("expected the error rate to be set, got %d", code)
+	}
+	if got := statusCodes(t, url, 3); got[http.StatusServiceUnavailable] != 3 {
+		t.Fatalf("expected every request to fail, got %v", got)
+	}
+	for _, invalid := range []string{"?rate=2", "?rate=NaN", "?rate=abc"} {
+		if code := admin(invalid); code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", invalid, code)
+		}
+	}
+	if code := admin("?rate=0"); code != http.StatusOK {
+		t.Fatalf("expected the error rate to be set, got %d", code)
+	}
+	if got := statusCodes(t, url, 3); got[http.StatusOK] != 3 {
+		t.Fatalf("expected every request to succeed, got %v", got)
+	}
+}
+
+// requestDurations makes n requests to url and returns how long each took.
+func requestDurations(t *testing.T, url string, n int) []time.Duration {
+	t.Helper()
+	out := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		out = append(out, time.Since(start))
+	}
+	return out
+}
+
+// countDelayed returns the number of durations that are at least delay.
+func countDelayed(durations []time.Duration, delay time.Duration) int {
+	n := 0
+	for _, d := range durations {
+		if d >= delay {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDelay(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	cases := []struct {
+		percentage float64
+		want       int
+	}{
+		{0, 0},
+		{50, 2},
+		{100, 4},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprint(tt.percentage), func(t *testing.T) {
+			_, url := startServer(t, Config{DelayPercentage: tt.percentage, DelayDuration: delay})
+			if got := countDelayed(requestDurations(t, url, 4), delay); got != tt.want {
+				t.Fatalf("expected %d of 4 requests to be delayed by %v, got %d", tt.want, delay, got)
+			}
+		})
+	}
+}
+
+func TestDelayInvalid(t *testing.T) {
+	cases := []struct {
+		percentage float64
+		duration   time.Duration
+	}{
+		{-1, time.Second},
+		{101, time.Second},
+		{math.NaN(), time.Second},
+		{50, -time.Second},
+	}
+	for _, tt := range cases {
+		s := New(Config{DelayPercentage: tt.percentage, DelayDuration: tt.duration})
+		if err := s.Start(); err == nil {
+			t.Errorf("expected delay %v%% of %v to be rejected", tt.percentage, tt.duration)
+		}
+	}
+}
+
+func TestHandleDelay(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	s, url := startServer(t, Config{})
+	admin := func(body string) (int, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleDelay(w, httptest.NewRequest(http.MethodPost, "/admin/delay", strings.NewReader(body)))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	code, got := admin(`{"percentage": 100, "duration": "200ms"}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected the delay to be set, got %d: %s", code, got)
+	}
+	if want := `{"percentage":100,"duration":"200ms"}`; got != want {
+		t.Fatalf("expected delay config %s, got %s", want, got)
+	}
+	if got := countDelayed(requestDurations(t, url, 2), delay); got != 2 {
+		t.Fatalf("expected every request to be delayed by %v, got %d of 2", delay, got)
+	}
+	for _, invalid := range []string{
+		`{"percentage": 101, "duration": "200ms"}`,
+		`{"percentage": 50, "duration": "-1s"}`,
+		`{"percentage": 50, "duration": "soon"}`,
+		`not json`,
+	} {
+		if code, _ := admin(invalid); code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", invalid, code)
+		}
+	}
+	if code, _ := admin(`{"percentage": 0}`); code != http.StatusOK {
+		t.Fatalf("expected the delay to be cleared, got %d", code)
+	}
+	if got := countDelayed(requestDurations(t, url, 2), delay); got != 0 {
+		t.Fatalf("expected no request to be delayed, got %d of 2", got)
+	}
+}
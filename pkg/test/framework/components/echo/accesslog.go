@@ -0,0 +1,71 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccessLogMatcher matches entries of an Envoy access log, in either the default text or JSON format. Only
+// non-zero fields are matched.
+type AccessLogMatcher struct {
+	// SourceIP is the IP address of the downstream peer.
+	SourceIP string
+	// DestinationFQDN is the host the request was sent to.
+	DestinationFQDN string
+	// ResponseCode of the request.
+	ResponseCode int
+	// TraceID of the request.
+	TraceID string
+}
+
+// Matches returns true if the access log entry matches all of the set fields.
+func (m AccessLogMatcher) Matches(entry string) bool {
+	if m.SourceIP != "" && !strings.Contains(entry, m.SourceIP+":") {
+		return false
+	}
+	if m.DestinationFQDN != "" && !strings.Contains(entry, m.DestinationFQDN) {
+		return false
+	}
+	if m.ResponseCode != 0 {
+		text := fmt.Sprintf(`" %d `, m.ResponseCode)
+		json := fmt.Sprintf(`"response_code":%d`, m.ResponseCode)
+		if !strings.Contains(entry, text) && !strings.Contains(entry, json) {
+			return false
+		}
+	}
+	if m.TraceID != "" && !strings.Contains(entry, m.TraceID) {
+		return false
+	}
+	return true
+}
+
+func (m AccessLogMatcher) String() string {
+	var parts []string
+	if m.SourceIP != "" {
+		parts = append(parts, "source="+m.SourceIP)
+	}
+	if m.DestinationFQDN != "" {
+		parts = append(parts, "destination="+m.DestinationFQDN)
+	}
+	if m.ResponseCode != 0 {
+		parts = append(parts, fmt.Sprintf("code=%d", m.ResponseCode))
+	}
+	if m.TraceID != "" {
+		parts = append(parts, "trace="+m.TraceID)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
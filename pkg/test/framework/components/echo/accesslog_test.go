@@ -0,0 +1,52 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo_test
+
+import (
+	"testing"
+
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+func TestAccessLogMatcher(t *testing.T) {
+	text := `[2022-05-05T17:36:31.640Z] "GET / HTTP/1.1" 200 - via_upstream - "-" 0 1005 1 0 "-" "Go-http-client/1.1" ` +
+		`"2a7a7f6e-1234-4c6a-9b0c-4d3f0a6c0e39" "b.echo1:80" "10.0.0.2:8080" inbound|8080|| 127.0.0.6:43771 ` +
+		`10.0.0.2:8080 10.0.0.1:52134 outbound_.80_._.b.echo1.svc.cluster.local default`
+	json := `{"response_code":503,"downstream_remote_address":"10.0.0.1:52134","authority":"b.echo1.svc.cluster.local"}`
+	cases := []struct {
+		name    string
+		matcher echo.AccessLogMatcher
+		entry   string
+		want    bool
+	}{
+		{"empty", echo.AccessLogMatcher{}, text, true},
+		{"all fields", echo.AccessLogMatcher{
+			SourceIP:        "10.0.0.1",
+			DestinationFQDN: "b.echo1.svc.cluster.local",
+			ResponseCode:    200,
+			TraceID:         "2a7a7f6e-1234-4c6a-9b0c-4d3f0a6c0e39",
+		}, text, true},
+		{"wrong code", echo.AccessLogMatcher{ResponseCode: 503}, text, false},
+		{"wrong source", echo.AccessLogMatcher{SourceIP: "10.0.0.3"}, text, false},
+		{"json code", echo.AccessLogMatcher{ResponseCode: 503, SourceIP: "10.0.0.1"}, json, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.matcher.Matches(tt.entry); got != tt.want {
+				t.Fatalf("Matches(%v) = %v, want %v", tt.matcher, got, tt.want)
+			}
+		})
+	}
+}
@@ -123,12 +123,18 @@ func (a Annotations) getOrDefault(k Annotation) *AnnotationValue {
 }
 
 func (a Annotations) GetByName(k string) string {
+	v, _ := a.LookupByName(k)
+	return v
+}
+
+// LookupByName returns the value of the annotation with the given name, and whether it was present.
+func (a Annotations) LookupByName(k string) (string, bool) {
 	for keys := range a {
 		if keys.Name == k {
-			return a.Get(keys)
+			return a.Get(keys), true
 		}
 	}
-	return ""
+	return "", false
 }
 
 func (a Annotations) Get(k Annotation) string {
@@ -15,11 +15,13 @@
 package echo
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"google.golang.org/grpc/codes"
 	wrappers "google.golang.org/protobuf/types/known/wrapperspb"
 
 	"istio.io/istio/pkg/http/headers"
@@ -29,6 +31,9 @@ import (
 	"istio.io/istio/pkg/test/util/retry"
 )
 
+// FilterMetadataHeader is the request header that carries CallOptions.FilterMetadata.
+const FilterMetadataHeader = "X-Echo-Filter-Metadata"
+
 // HTTP settings
 type HTTP struct {
 	// If true, h2c will be used in HTTP requests
@@ -87,6 +92,24 @@ type TCP struct {
 	ExpectedResponse *wrappers.StringValue
 }
 
+// GRPC settings
+type GRPC struct {
+	// StatusCode, if not OK, asks the server to fail gRPC requests with this status code.
+	StatusCode codes.Code
+}
+
+// ProxyProtocolVersion is a version of the PROXY protocol used to prefix a call's connections.
+type ProxyProtocolVersion int
+
+const (
+	// NoProxyProtocol sends no PROXY protocol header.
+	NoProxyProtocol ProxyProtocolVersion = iota
+	// ProxyProtocolV1 sends the human-readable version 1 header.
+	ProxyProtocolV1
+	// ProxyProtocolV2 sends the binary version 2 header.
+	ProxyProtocolV2
+)
+
 // Target of a call.
 type Target interface {
 	Configurable
@@ -130,12 +153,25 @@ type CallOptions struct {
 	// TCP settings.
 	TCP TCP
 
+	// GRPC settings.
+	GRPC GRPC
+
 	// TLS settings.
 	TLS TLS
 
 	// Message to be sent.
 	Message string
 
+	// FilterMetadata is JSON encoded and sent with HTTP requests in the FilterMetadataHeader, so that an
+	// EnvoyFilter (e.g. header_to_metadata) or Wasm extension in the sidecar can turn it into Envoy dynamic
+	// metadata.
+	FilterMetadata map[string]interface{}
+
+	// ProxyProtocol, if set, makes the client write a PROXY protocol header of this version to each
+	// new TCP connection, as an upstream load balancer would. Only supported for HTTP(S) and TCP calls
+	// that don't use HTTP/3; other calls fail.
+	ProxyProtocol ProxyProtocolVersion
+
 	// Check the server responses. If none is provided, only the number of responses received
 	// will be checked.
 	Check check.Checker
@@ -173,6 +209,12 @@ func (o CallOptions) DeepCopy() CallOptions {
 		clone.TLS.Alpn = make([]string, len(o.TLS.Alpn))
 		copy(clone.TLS.Alpn, o.TLS.Alpn)
 	}
+	if o.FilterMetadata != nil {
+		clone.FilterMetadata = make(map[string]interface{}, len(o.FilterMetadata))
+		for k, v := range o.FilterMetadata {
+			clone.FilterMetadata[k] = v
+		}
+	}
 	return clone
 }
 
@@ -194,7 +236,9 @@ func (o *CallOptions) FillDefaults() error {
 	}
 
 	// Fill in HTTP headers
-	o.fillHeaders()
+	if err := o.fillHeaders(); err != nil {
+		return err
+	}
 
 	if o.Timeout <= 0 {
 		o.Timeout = common.DefaultRequestTimeout
@@ -283,7 +327,7 @@ func (o *CallOptions) fillScheme() error {
 	return nil
 }
 
-func (o *CallOptions) fillHeaders() {
+func (o *CallOptions) fillHeaders() error {
 	// Initialize the headers and add a default Host header if none provided.
 	if o.HTTP.Headers == nil {
 		o.HTTP.Headers = make(http.Header)
@@ -295,4 +339,13 @@ func (o *CallOptions) fillHeaders() {
 	if h := o.GetHost(); len(h) > 0 {
 		o.HTTP.Headers.Set(headers.Host, h)
 	}
+
+	if len(o.FilterMetadata) > 0 {
+		b, err := json.Marshal(o.FilterMetadata)
+		if err != nil {
+			return fmt.Errorf("callOptions: invalid filter metadata: %v", err)
+		}
+		o.HTTP.Headers.Set(FilterMetadataHeader, string(b))
+	}
+	return nil
 }
@@ -63,6 +63,9 @@ func callInternal(srcName string, opts *echo.CallOptions, send sendFunc) (echocl
 		InsecureSkipVerify: opts.TLS.InsecureSkipVerify,
 		FollowRedirects:    opts.HTTP.FollowRedirects,
 		ServerName:         opts.TLS.ServerName,
+
+		ProxyProtocolVersion: int32(opts.ProxyProtocol),
+		GrpcStatusCode:       int32(opts.GRPC.StatusCode),
 	}
 	if opts.TLS.Alpn != nil {
 		req.Alpn = &proto.Alpn{
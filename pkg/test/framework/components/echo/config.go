@@ -93,6 +93,11 @@ type Config struct {
 	// as well.
 	StatefulSet bool
 
+	// DNSRegistered (k8s only) indicates that no Kubernetes Service should be created. Instead, the
+	// workloads are registered with a ServiceEntry for the service's cluster-local FQDN, so clients
+	// must resolve it via the Istio DNS proxy (with DNS capture and auto allocation enabled).
+	DNSRegistered bool
+
 	// StaticAddress for some echo implementations is an address locally reachable within
 	// the test framework and from the echo Cluster's network.
 	StaticAddresses []string
@@ -135,6 +140,11 @@ type Config struct {
 	// If enabled, ISTIO_META_AUTO_REGISTER_GROUP will be set on the VM and the WorkloadEntry will be created automatically.
 	AutoRegisterVM bool
 
+	// If enabled, sidecar injection is disabled and the echo pods are labeled with istio.io/dataplane-mode=ambient.
+	// This only labels the pods: the framework does not install ztunnel or any other ambient dataplane, so unless
+	// the cluster already runs one, the pods are deployed without any proxy.
+	AmbientMode bool
+
 	// The distro to use for a VM. For fake VMs, this maps to docker images.
 	VMDistro VMDistro
 
@@ -146,6 +156,19 @@ type Config struct {
 	// the same pod.
 	IncludeExtAuthz bool
 
+	// If enabled, the echo server accepts HTTP CONNECT requests on its HTTP ports and tunnels them to the requested
+	// host, acting as a forward proxy.
+	ConnectProxy bool
+
+	// ErrorRate is the fraction of HTTP requests, between 0 and 1, that the echo server fails with a 503. The
+	// failures are spread evenly across requests.
+	ErrorRate float64
+
+	// DelayPercentage is the percentage of HTTP requests, between 0 and 100, that the echo server delays by
+	// DelayDuration before handling them. The delays are spread evenly across requests.
+	DelayPercentage float64
+	DelayDuration   time.Duration
+
 	// IPFamily for the service. This is optional field. Mainly is used for dual stack testing
 	IPFamilies string
 
@@ -237,6 +260,30 @@ func (c Config) IsProxylessGRPC() bool {
 	return len(c.Subsets) > 0 && c.Subsets[0].Annotations != nil && strings.HasPrefix(c.Subsets[0].Annotations.Get(SidecarInjectTemplates), "grpc-")
 }
 
+// IsGateway returns true if any subset is injected with the gateway template, deploying a gateway proxy rather
+// than a sidecar.
+func (c Config) IsGateway() bool {
+	for _, s := range c.Subsets {
+		if s.Annotations == nil {
+			continue
+		}
+		for _, t := range strings.Split(s.Annotations.Get(SidecarInjectTemplates), ",") {
+			if strings.TrimSpace(t) == "gateway" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ServiceAccountName returns the name of the Kubernetes service account used by the workloads.
+func (c Config) ServiceAccountName() string {
+	if c.ServiceAccount {
+		return c.Service
+	}
+	return "default"
+}
+
 func (c Config) IsTProxy() bool {
 	// TODO this could be HasCustomInjectionMode
 	return len(c.Subsets) > 0 && c.Subsets[0].Annotations != nil && c.Subsets[0].Annotations.Get(SidecarInterceptionMode) == "TPROXY"
@@ -261,6 +308,24 @@ func (c Config) IsRegularPod() bool {
 	return len(c.Subsets) == 1 && !c.IsVM() && !c.IsTProxy() && !c.IsNaked() && !c.IsHeadless() && !c.IsStatefulSet() && !c.IsProxylessGRPC()
 }
 
+// SubsetLabels returns the labels applied to the workloads of each subset, in order. These mirror the labels
+// set on pods by the Kubernetes deployment template.
+func (c Config) SubsetLabels() []map[string]string {
+	out := make([]map[string]string, 0, len(c.Subsets))
+	for _, s := range c.Subsets {
+		l := map[string]string{
+			"app":                 c.Service,
+			"version":             s.Version,
+			"test.istio.io/class": string(c.WorkloadClass()),
+		}
+		if c.Locality != "" {
+			l["istio-locality"] = c.Locality
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
 // DeepCopy creates a clone of IstioEndpoint.
 func (c Config) DeepCopy() Config {
 	newc := c
@@ -316,6 +381,12 @@ func (c *Config) FillDefaults(ctx resource.Context) (err error) {
 		if c.Subsets[i].Version == "" {
 			c.Subsets[i].Version = c.Version
 		}
+		if c.AmbientMode {
+			if c.Subsets[i].Annotations == nil {
+				c.Subsets[i].Annotations = NewAnnotations()
+			}
+			c.Subsets[i].Annotations.SetBool(SidecarInject, false)
+		}
 	}
 	c.addPortIfMissing(protocol.GRPC)
 	// If no namespace was provided, use the default.
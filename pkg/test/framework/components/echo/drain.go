@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"context"
+	"time"
+)
+
+// DrainReport summarizes the traffic sent while SimulateDrain restarted a set of Instances.
+type DrainReport struct {
+	// Requests is the number of times the traffic function was invoked.
+	Requests int
+	// Errors returned by the traffic function during the restart.
+	Errors []error
+	// Duration of the restart.
+	Duration time.Duration
+	// RestartError is set if the Instances could not be restarted, or the context was done first.
+	RestartError error
+}
+
+// ErrorRate returns the fraction of requests that failed during the restart.
+func (r DrainReport) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(len(r.Errors)) / float64(r.Requests)
+}
+
+// SimulateDrain performs a rolling restart of the given Instances while repeatedly invoking trafficFunc, which
+// should send a single request and return any error encountered. Traffic stops once all Instances have been
+// restarted or the context is done. The returned report can be used to verify that connections were drained
+// gracefully.
+//
+// Restarts cannot be cancelled, so if the context is done first, SimulateDrain returns with the context's error
+// as the RestartError while the rollouts continue in the background.
+func SimulateDrain(ctx context.Context, instances Instances, trafficFunc func() error) DrainReport {
+	var report DrainReport
+	done := make(chan struct{})
+	trafficDone := make(chan struct{})
+	go func() {
+		defer close(trafficDone)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+			report.Requests++
+			if err := trafficFunc(); err != nil {
+				report.Errors = append(report.Errors, err)
+			}
+		}
+	}()
+
+	start := time.Now()
+	restartDone := make(chan error, 1)
+	go func() {
+		restartDone <- instances.Restart()
+	}()
+	select {
+	case err := <-restartDone:
+		report.RestartError = err
+	case <-ctx.Done():
+		report.RestartError = ctx.Err()
+	}
+	report.Duration = time.Since(start)
+
+	close(done)
+	<-trafficDone
+	return report
+}
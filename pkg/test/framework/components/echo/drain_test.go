@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+type fakeRestarter struct {
+	fakeInstance
+	restart func() error
+}
+
+func (f fakeRestarter) Restart() error {
+	return f.restart()
+}
+
+func TestSimulateDrain(t *testing.T) {
+	restarted := make(chan struct{})
+	requests := 0
+	inst := fakeRestarter{fakeInstance: *a1, restart: func() error {
+		<-restarted
+		return nil
+	}}
+	report := echo.SimulateDrain(context.Background(), echo.Instances{inst}, func() error {
+		requests++
+		switch requests {
+		case 2:
+			return errors.New("connection reset")
+		case 3:
+			return errors.New("upstream connect error")
+		case 4:
+			close(restarted)
+		}
+		return nil
+	})
+	if report.RestartError != nil {
+		t.Fatal(report.RestartError)
+	}
+	if report.Requests != requests || report.Requests < 4 {
+		t.Fatalf("expected at least 4 requests to be counted, got %d of %d", report.Requests, requests)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].Error() != "connection reset" ||
+		report.Errors[1].Error() != "upstream connect error" {
+		t.Fatalf("unexpected errors: %v", report.Errors)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	ok := fakeRestarter{fakeInstance: *a1, restart: func() error { return nil }}
+	if err := (echo.Instances{ok, ok}).Restart(); err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	failed := fakeRestarter{fakeInstance: *a2, restart: func() error { return errors.New("rollout failed") }}
+	if err := (echo.Instances{ok, failed}).Restart(); err == nil {
+		t.Fatal("expected the failed restart to be returned")
+	}
+}
+
+func TestSimulateDrainContextDone(t *testing.T) {
+	restarted := make(chan struct{})
+	defer close(restarted)
+	inst := fakeRestarter{fakeInstance: *a1, restart: func() error {
+		<-restarted
+		return nil
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report := echo.SimulateDrain(ctx, echo.Instances{inst}, func() error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if !errors.Is(report.RestartError, context.DeadlineExceeded) {
+		t.Fatalf("expected the context's error, got %v", report.RestartError)
+	}
+	if report.Requests == 0 {
+		t.Fatal("expected traffic to be sent until the context was done")
+	}
+}
@@ -35,10 +35,15 @@ type T struct {
 	destinationDeploymentSetup []dstSetupFn
 }
 
-// New creates a *T using the given applications as sources and destinations for each subtest.
+// New creates a *T using the given applications as sources and destinations for each subtest. Instances that are not
+// deployed to a cluster, such as an echo.ExternalService, cannot make calls and are only used as destinations.
 func New(ctx framework.TestContext, instances echo.Instances) *T {
-	s, d := make(echo.Instances, len(instances)), make(echo.Instances, len(instances))
-	copy(s, instances)
+	s, d := make(echo.Instances, 0, len(instances)), make(echo.Instances, len(instances))
+	for _, i := range instances {
+		if i.Config().Cluster != nil {
+			s = append(s, i)
+		}
+	}
 	copy(d, instances)
 	t := &T{rootCtx: ctx, sources: s, destinations: d}
 	if ctx.Settings().Skip(echo.VM) {
@@ -124,7 +124,7 @@ func oneRegularPodPerNamespace(exclude echo.Instances) Filter {
 			}
 		}
 
-		return outServices.Instances()
+		return outServices.AllInstances()
 	}
 }
 
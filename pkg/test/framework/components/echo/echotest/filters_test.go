@@ -15,6 +15,7 @@
 package echotest_test
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -272,6 +273,26 @@ func TestRun(t *testing.T) {
 					},
 				},
 			},
+			"Run_WithExternalService": {
+				run: func(t framework.TestContext, testTopology map[string]map[string]int) {
+					external := echo.NewExternalService(echo1NS, "api.example.com", "10.0.0.1", nil)
+					echotest.New(t, echo.Instances{a1, a2, external}).
+						Run(func(ctx framework.TestContext, from echo.Instance, to echo.Target) {
+							fromKey := from.Config().ClusterLocalFQDN()
+							if testTopology[fromKey] == nil {
+								testTopology[fromKey] = map[string]int{}
+							}
+							testTopology[fromKey][to.Config().ClusterLocalFQDN()]++
+						})
+				},
+				expect: map[string]map[string]int{
+					// The external service is only a destination, since it cannot make calls.
+					"a.echo1.svc.cluster.local": {
+						"a.echo1.svc.cluster.local":   2,
+						"api.echo1.svc.cluster.local": 2,
+					},
+				},
+			},
 			"RunToN": {
 				run: func(t framework.TestContext, testTopology map[string]map[string]int) {
 					echotest.New(t, all).
@@ -387,3 +408,7 @@ func (f fakeInstance) CallOrFail(test.Failer, echo.CallOptions) echoClient.Respo
 func (f fakeInstance) Restart() error {
 	panic("implement me")
 }
+
+func (f fakeInstance) ExecCommand(context.Context, string, ...string) (string, string, error) {
+	panic("implement me")
+}
@@ -120,7 +120,7 @@ func (t *T) RunToN(n int, testFn oneToNTest) {
 			t.fromEachWorkloadCluster(ctx, from, func(ctx framework.TestContext, fromInstance echo.Instance) {
 				// reapply destination filters to only get the reachable instances for this cluster
 				// this can be done safely since toNDeployments asserts the Services won't change
-				destDeployments := t.applyCombinationFilters(fromInstance, toServices.Instances()).Services()
+				destDeployments := t.applyCombinationFilters(fromInstance, toServices.AllInstances()).Services()
 				testFn(ctx, fromInstance, destDeployments)
 			})
 		})
@@ -68,7 +68,7 @@ func (t *T) hasSourceSetup() bool {
 //     ...
 func (t *T) SetupForPair(setupFn func(ctx framework.TestContext, from echo.Callers, dsts echo.Instances) error) *T {
 	return t.SetupForServicePair(func(ctx framework.TestContext, from echo.Callers, dsts echo.Services) error {
-		return setupFn(ctx, from, dsts.Instances())
+		return setupFn(ctx, from, dsts.AllInstances())
 	})
 }
 
@@ -101,7 +101,7 @@ func (t *T) setupPair(ctx framework.TestContext, from echo.Callers, dsts echo.Se
 		}
 	}
 	for _, setupFn := range t.destinationDeploymentSetup {
-		if err := setupFn(ctx, dsts.Instances()); err != nil {
+		if err := setupFn(ctx, dsts.AllInstances()); err != nil {
 			ctx.Fatal(err)
 		}
 	}
@@ -0,0 +1,166 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networking "istio.io/api/networking/v1alpha3"
+	networkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/echo"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+// ExternalServiceNamespace is the namespace that WithExternalService places an ExternalService in when the
+// Services do not all share a single namespace.
+const ExternalServiceNamespace = "default"
+
+var _ Instance = &ExternalService{}
+
+// ExternalService is a synthetic Instance for a service outside the mesh. Rather than being deployed, it is
+// registered with the mesh by the ServiceEntry returned from ServiceEntry, which tests are responsible for
+// applying. It has no workloads and is not deployed to any cluster, so it can be called but cannot make calls
+// itself, and its Config().Cluster is nil. Services helpers that are keyed by cluster skip it.
+type ExternalService struct {
+	cfg     Config
+	address string
+}
+
+// NewExternalService returns an ExternalService for host in namespace ns, resolving to ip and exposing the given
+// ports.
+func NewExternalService(ns namespace.Instance, host, ip string, ports []Port) *ExternalService {
+	service := host
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		service = host[:i]
+	}
+	return &ExternalService{
+		cfg: Config{
+			Service:           service,
+			Namespace:         ns,
+			Domain:            defaultDomain,
+			DefaultHostHeader: host,
+			Ports:             append(Ports{}, ports...),
+		},
+		address: ip,
+	}
+}
+
+// ServiceEntry returns the ServiceEntry that registers this service with the mesh.
+func (e *ExternalService) ServiceEntry() *networkingv1alpha3.ServiceEntry {
+	ports := make([]*networking.Port, 0, len(e.cfg.Ports))
+	for _, p := range e.cfg.Ports {
+		ports = append(ports, &networking.Port{
+			Number:   uint32(p.ServicePort),
+			Protocol: string(p.Protocol),
+			Name:     p.Name,
+		})
+	}
+	return &networkingv1alpha3.ServiceEntry{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      e.cfg.Service,
+			Namespace: e.cfg.Namespace.Name(),
+		},
+		Spec: networking.ServiceEntry{
+			Hosts:      []string{e.cfg.DefaultHostHeader},
+			Ports:      ports,
+			Location:   networking.ServiceEntry_MESH_EXTERNAL,
+			Resolution: networking.ServiceEntry_STATIC,
+			Endpoints:  []*networking.WorkloadEntry{{Address: e.address}},
+		},
+	}
+}
+
+func (e *ExternalService) ID() resource.ID {
+	return resource.FakeID(e.cfg.DefaultHostHeader)
+}
+
+func (e *ExternalService) Config() Config {
+	return e.cfg
+}
+
+func (e *ExternalService) NamespacedName() model.NamespacedName {
+	return e.cfg.NamespacedName()
+}
+
+func (e *ExternalService) PortForName(name string) Port {
+	return e.cfg.Ports.MustForName(name)
+}
+
+func (e *ExternalService) Address() string {
+	return e.address
+}
+
+func (e *ExternalService) Addresses() []string {
+	return []string{e.address}
+}
+
+func (e *ExternalService) Instances() Instances {
+	return Instances{e}
+}
+
+func (e *ExternalService) Workloads() (Workloads, error) {
+	return Workloads{}, nil
+}
+
+func (e *ExternalService) WorkloadsOrFail(t test.Failer) Workloads {
+	t.Helper()
+	out, err := e.Workloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func (e *ExternalService) MustWorkloads() Workloads {
+	out, err := e.Workloads()
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (e *ExternalService) Clusters() cluster.Clusters {
+	return nil
+}
+
+func (e *ExternalService) Call(CallOptions) (echo.Responses, error) {
+	return nil, fmt.Errorf("cannot call from external service %s", e.cfg.DefaultHostHeader)
+}
+
+func (e *ExternalService) CallOrFail(t test.Failer, opts CallOptions) echo.Responses {
+	t.Helper()
+	r, err := e.Call(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func (e *ExternalService) Restart() error {
+	return errors.New("cannot restart an external service")
+}
+
+func (e *ExternalService) ExecCommand(context.Context, string, ...string) (string, string, error) {
+	return "", "", errors.New("cannot exec commands on an external service")
+}
@@ -15,6 +15,8 @@
 package echo
 
 import (
+	"context"
+
 	"istio.io/istio/pkg/test/framework/resource"
 )
 
@@ -32,4 +34,15 @@ type Instance interface {
 
 	// Restart restarts the workloads associated with this echo instance
 	Restart() error
+
+	// ExecCommand runs cmd in the given container of the first ready workload of this echo instance
+	// and returns its output.
+	ExecCommand(ctx context.Context, container string, cmd ...string) (stdout, stderr string, err error)
+}
+
+// Scaler is implemented by Instances whose workloads can be scaled, such as Kubernetes deployments.
+type Scaler interface {
+	// Scale sets the number of replicas of each subset and waits for the rollout to complete. An error is returned
+	// if the rollout does not complete before the context is done.
+	Scale(ctx context.Context, replicas int) error
 }
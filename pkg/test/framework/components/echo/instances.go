@@ -15,7 +15,9 @@
 package echo
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sort"
 
 	"github.com/hashicorp/go-multierror"
@@ -66,7 +68,9 @@ func (i Instances) Callers() Callers {
 func (i Instances) Clusters() cluster.Clusters {
 	clusters := map[string]cluster.Cluster{}
 	for _, instance := range i {
-		clusters[instance.Config().Cluster.Name()] = instance.Config().Cluster
+		if c := instance.Config().Cluster; c != nil {
+			clusters[c.Name()] = c
+		}
 	}
 	out := make(cluster.Clusters, 0, len(clusters))
 	for _, c := range clusters {
@@ -114,6 +118,33 @@ func (i Instances) IsDeployment() bool {
 	return len(i.Services()) == 1
 }
 
+// IsGateway returns true if the Instances are deployed as gateway proxies.
+func (i Instances) IsGateway() bool {
+	return i.Config().IsGateway()
+}
+
+const (
+	// DataplaneModeLabel enrolls a namespace or pod in a dataplane mode.
+	DataplaneModeLabel = "istio.io/dataplane-mode"
+	// DataplaneModeAmbient is the DataplaneModeLabel value for ambient (ztunnel-based) mode.
+	DataplaneModeAmbient = "ambient"
+)
+
+// IsAmbientEnabled returns true if every one of the Instances was deployed with Config.AmbientMode, which labels
+// its pods with DataplaneModeLabel set to ambient. Like the other predicates, this is decided from the Config
+// alone, so namespaces or pods labeled outside of the framework are not detected.
+func (i Instances) IsAmbientEnabled() bool {
+	if len(i) == 0 {
+		return false
+	}
+	for _, instance := range i {
+		if !instance.Config().AmbientMode {
+			return false
+		}
+	}
+	return true
+}
+
 func (i Instances) ContainsTarget(t Target) bool {
 	return i.Contains(t.Instances()...)
 }
@@ -167,5 +198,31 @@ func (i Instances) Restart() error {
 		app := app
 		g.Go(app.Restart)
 	}
-	return g.Wait()
+	return g.Wait().ErrorOrNil()
+}
+
+// Scale each Instance to the given number of replicas and wait for the rollouts to complete. An error is returned if
+// any Instance does not implement Scaler.
+func (i Instances) Scale(ctx context.Context, replicas int) error {
+	// Check every Instance before scaling any of them, so that an error doesn't leave the Instances half-scaled.
+	scalers := make([]Scaler, 0, len(i))
+	for _, app := range i {
+		scaler, ok := app.(Scaler)
+		if !ok {
+			name := app.Config().ClusterLocalFQDN()
+			if c := app.Config().Cluster; c != nil {
+				name += " in cluster " + c.Name()
+			}
+			return fmt.Errorf("echo %s does not support scaling", name)
+		}
+		scalers = append(scalers, scaler)
+	}
+	g := multierror.Group{}
+	for _, scaler := range scalers {
+		scaler := scaler
+		g.Go(func() error {
+			return scaler.Scale(ctx, replicas)
+		})
+	}
+	return g.Wait().ErrorOrNil()
 }
@@ -0,0 +1,373 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"google.golang.org/protobuf/proto"
+	kubeCore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+	telemetry "istio.io/api/telemetry/v1alpha1"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/util/protomarshal"
+	"istio.io/istio/pkg/util/strcase"
+)
+
+const (
+	istiodLabelSelector = "app=istiod"
+	istiodContainerName = "discovery"
+)
+
+// istiodDebugRequest sends a GET request for the given debug path (e.g. /debug/syncz) to a running istiod in the
+// primary cluster for c, and returns the response body.
+func istiodDebugRequest(ctx context.Context, c cluster.Cluster, path string) (string, error) {
+	primary := c.Primary()
+	pods, err := primary.PodsForSelector(ctx, metav1.NamespaceAll, istiodLabelSelector)
+	if err != nil {
+		return "", fmt.Errorf("failed listing istiod pods in cluster %s: %v", primary.Name(), err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != kubeCore.PodRunning {
+			continue
+		}
+		command := "pilot-discovery request GET " + path
+		stdout, stderr, err := primary.PodExec(pod.Name, pod.Namespace, istiodContainerName, command)
+		if err != nil {
+			return "", fmt.Errorf("failed exec on istiod %s/%s: %v. Command: %s. Output:\n%s",
+				pod.Namespace, pod.Name, err, command, stdout+stderr)
+		}
+		return stdout, nil
+	}
+	return "", fmt.Errorf("no running istiod found in cluster %s", primary.Name())
+}
+
+// proxy identifies the sidecar of a single workload of a service.
+type proxy struct {
+	fqdn      string
+	podName   string
+	namespace string
+	cluster   cluster.Cluster
+}
+
+// ID returns the proxy ID as used by istiod debug endpoints.
+func (p proxy) ID() string {
+	return p.podName + "." + p.namespace
+}
+
+// matches returns true if the given xDS node ID (e.g. sidecar~10.0.0.1~pod.ns~ns.svc.cluster.local) is for
+// this proxy.
+func (p proxy) matches(nodeID string) bool {
+	return nodeID == p.ID() || strings.Contains(nodeID, "~"+p.ID()+"~")
+}
+
+// proxies returns the proxies of all the ready workloads in the Services.
+func (d Services) proxies() ([]proxy, error) {
+	var out []proxy
+	for _, target := range d {
+		for _, instance := range target {
+			workloads, err := instance.Workloads()
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range workloads {
+				out = append(out, proxy{
+					fqdn:      instance.Config().ClusterLocalFQDN(),
+					podName:   w.PodName(),
+					namespace: instance.Config().Namespace.Name(),
+					cluster:   w.Cluster(),
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// syncStatus is the per-proxy status reported by istiod's /debug/syncz.
+type syncStatus struct {
+	ProxyID       string `json:"proxy,omitempty"`
+	ClusterSent   string `json:"cluster_sent,omitempty"`
+	ClusterAcked  string `json:"cluster_acked,omitempty"`
+	ListenerSent  string `json:"listener_sent,omitempty"`
+	ListenerAcked string `json:"listener_acked,omitempty"`
+	RouteSent     string `json:"route_sent,omitempty"`
+	RouteAcked    string `json:"route_acked,omitempty"`
+	EndpointSent  string `json:"endpoint_sent,omitempty"`
+	EndpointAcked string `json:"endpoint_acked,omitempty"`
+}
+
+func getSyncz(ctx context.Context, c cluster.Cluster) ([]syncStatus, error) {
+	out, err := istiodDebugRequest(ctx, c, "/debug/syncz")
+	if err != nil {
+		return nil, err
+	}
+	var statuses []syncStatus
+	if err := json.Unmarshal([]byte(out), &statuses); err != nil {
+		return nil, fmt.Errorf("failed parsing syncz: %v", err)
+	}
+	return statuses, nil
+}
+
+// checkSynced returns an error if the proxy is not connected to istiod, or any xDS type sent to it is not yet
+// acknowledged.
+func checkSynced(p proxy, statuses []syncStatus) error {
+	for _, s := range statuses {
+		if !p.matches(s.ProxyID) {
+			continue
+		}
+		for _, x := range []struct{ typ, sent, acked string }{
+			{"CDS", s.ClusterSent, s.ClusterAcked},
+			{"LDS", s.ListenerSent, s.ListenerAcked},
+			{"RDS", s.RouteSent, s.RouteAcked},
+			{"EDS", s.EndpointSent, s.EndpointAcked},
+		} {
+			if x.sent != "" && x.sent != x.acked {
+				return fmt.Errorf("proxy %s for %s is not synced: %s sent %q, acked %q", p.ID(), p.fqdn, x.typ, x.sent, x.acked)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("proxy %s for %s is not connected to istiod", p.ID(), p.fqdn)
+}
+
+// getEdsz returns the endpoints istiod has computed for each cluster of the given proxy.
+func getEdsz(ctx context.Context, p proxy) ([]*endpoint.ClusterLoadAssignment, error) {
+	out, err := istiodDebugRequest(ctx, p.cluster, "/debug/edsz?proxyID="+p.ID())
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing edsz for %s: %v", p.ID(), err)
+	}
+	cla := make([]*endpoint.ClusterLoadAssignment, 0, len(raw))
+	for _, r := range raw {
+		if string(r) == "null" {
+			continue
+		}
+		c := &endpoint.ClusterLoadAssignment{}
+		if err := protomarshal.UnmarshalAllowUnknown(r, c); err != nil {
+			return nil, fmt.Errorf("failed parsing edsz for %s: %v", p.ID(), err)
+		}
+		cla = append(cla, c)
+	}
+	return cla, nil
+}
+
+// sidecarz is the response of istiod's /debug/sidecarz, the SidecarScope computed for a proxy.
+type sidecarz struct {
+	Name                  string                            `json:"name"`
+	Namespace             string                            `json:"namespace"`
+	OutboundTrafficPolicy *networking.OutboundTrafficPolicy `json:"outboundTrafficPolicy"`
+	// Sidecar is the Sidecar resource the scope was computed from, or null for the default scope.
+	Sidecar json.RawMessage `json:"sidecar"`
+}
+
+// getSidecarz returns the SidecarScope istiod has computed for the given proxy.
+func getSidecarz(ctx context.Context, p proxy) (*sidecarz, error) {
+	out, err := istiodDebugRequest(ctx, p.cluster, "/debug/sidecarz?proxyID="+p.ID())
+	if err != nil {
+		return nil, err
+	}
+	sc := &sidecarz{}
+	if err := json.Unmarshal([]byte(out), sc); err != nil {
+		return nil, fmt.Errorf("failed parsing sidecarz for %s: %v", p.ID(), err)
+	}
+	return sc, nil
+}
+
+// telemetryz is the response of istiod's /debug/telemetryz.
+type telemetryz struct {
+	Telemetries struct {
+		NamespaceToTelemetries map[string][]struct {
+			Name      string               `json:"name"`
+			Namespace string               `json:"namespace"`
+			Spec      *telemetry.Telemetry `json:"spec"`
+		} `json:"namespace_to_telemetries"`
+		RootNamespace string `json:"root_namespace"`
+	} `json:"telemetries"`
+}
+
+func getTelemetryz(ctx context.Context, c cluster.Cluster) (*telemetryz, error) {
+	out, err := istiodDebugRequest(ctx, c, "/debug/telemetryz")
+	if err != nil {
+		return nil, err
+	}
+	t := &telemetryz{}
+	if err := json.Unmarshal([]byte(out), t); err != nil {
+		return nil, fmt.Errorf("failed parsing telemetryz: %v", err)
+	}
+	return t, nil
+}
+
+// effective returns the Telemetry that applies to workloads with the given config. A Telemetry selecting the
+// workload takes precedence over a namespace-wide one, which takes precedence over one in the root namespace.
+// Returns nil if no Telemetry applies.
+func (t *telemetryz) effective(cfg Config) *telemetry.Telemetry {
+	var namespaceWide *telemetry.Telemetry
+	for _, tel := range t.Telemetries.NamespaceToTelemetries[cfg.Namespace.Name()] {
+		if tel.Spec == nil {
+			continue
+		}
+		if tel.Spec.GetSelector() == nil {
+			if namespaceWide == nil {
+				namespaceWide = tel.Spec
+			}
+			continue
+		}
+		selector := labels.SelectorFromSet(tel.Spec.GetSelector().GetMatchLabels())
+		for _, l := range cfg.SubsetLabels() {
+			if selector.Matches(labels.Set(l)) {
+				return tel.Spec
+			}
+		}
+	}
+	if namespaceWide != nil {
+		return namespaceWide
+	}
+	for _, tel := range t.Telemetries.NamespaceToTelemetries[t.Telemetries.RootNamespace] {
+		if tel.Spec != nil && tel.Spec.GetSelector() == nil {
+			return tel.Spec
+		}
+	}
+	return nil
+}
+
+// configzEntry is a config reported by istiod's /debug/configz.
+type configzEntry struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name              string      `json:"name"`
+		Namespace         string      `json:"namespace"`
+		CreationTimestamp metav1.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Spec json.RawMessage `json:"spec"`
+}
+
+func (e configzEntry) is(gvk schema.GroupVersionKind) bool {
+	return e.APIVersion == gvk.GroupVersion().String() && e.Kind == gvk.Kind
+}
+
+// getConfigz returns all the configs istiod for the cluster c has.
+func getConfigz(ctx context.Context, c cluster.Cluster) ([]configzEntry, error) {
+	out, err := istiodDebugRequest(ctx, c, "/debug/configz")
+	if err != nil {
+		return nil, err
+	}
+	var configs []configzEntry
+	if err := json.Unmarshal([]byte(out), &configs); err != nil {
+		return nil, fmt.Errorf("failed parsing configz: %v", err)
+	}
+	return configs, nil
+}
+
+// hasConfig returns true if istiod for the cluster c has the given config.
+func hasConfig(ctx context.Context, c cluster.Cluster, gvk schema.GroupVersionKind, name, namespace string) (bool, error) {
+	configs, err := getConfigz(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	for _, cfg := range configs {
+		if cfg.is(gvk) && cfg.Metadata.Name == name && cfg.Metadata.Namespace == namespace {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getRootNamespace returns the root namespace of the mesh config used by istiod for the cluster c.
+func getRootNamespace(ctx context.Context, c cluster.Cluster) (string, error) {
+	out, err := istiodDebugRequest(ctx, c, "/debug/mesh")
+	if err != nil {
+		return "", err
+	}
+	mesh := &meshconfig.MeshConfig{}
+	if err := protomarshal.UnmarshalAllowUnknown([]byte(out), mesh); err != nil {
+		return "", fmt.Errorf("failed parsing mesh config: %v", err)
+	}
+	return mesh.RootNamespace, nil
+}
+
+// selectedConfig returns the spec of the most specific config of the given kind that applies to the workloads of
+// cfg: the oldest one in the workload's namespace whose selector (as returned by the selector func) matches the
+// workload, otherwise the oldest one in the workload's namespace without a selector, and otherwise the oldest one in
+// the root namespace without a selector. It returns nil if no config applies.
+func selectedConfig(configs []configzEntry, gvk schema.GroupVersionKind, rootNamespace string, cfg Config,
+	newSpec func() proto.Message, selector func(proto.Message) map[string]string) (proto.Message, error) {
+	candidates := make([]configzEntry, 0, len(configs))
+	for _, c := range configs {
+		if c.is(gvk) {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Metadata.CreationTimestamp.Before(&candidates[j].Metadata.CreationTimestamp)
+	})
+
+	var namespaceWide, meshWide proto.Message
+	for _, c := range candidates {
+		ns := c.Metadata.Namespace
+		if ns != cfg.Namespace.Name() && ns != rootNamespace {
+			continue
+		}
+		spec := newSpec()
+		if err := protomarshal.UnmarshalAllowUnknown(c.Spec, spec); err != nil {
+			return nil, fmt.Errorf("failed parsing %s %s/%s: %v", gvk.Kind, ns, c.Metadata.Name, err)
+		}
+		matchLabels := selector(spec)
+		if len(matchLabels) == 0 {
+			if ns == cfg.Namespace.Name() && namespaceWide == nil {
+				namespaceWide = spec
+			} else if ns == rootNamespace && meshWide == nil {
+				meshWide = spec
+			}
+			continue
+		}
+		if ns != cfg.Namespace.Name() {
+			continue
+		}
+		sel := labels.SelectorFromSet(matchLabels)
+		for _, l := range cfg.SubsetLabels() {
+			if sel.Matches(labels.Set(l)) {
+				return spec, nil
+			}
+		}
+	}
+	if namespaceWide != nil {
+		return namespaceWide, nil
+	}
+	return meshWide, nil
+}
+
+// configReferences returns the strings that identify the given config in generated Envoy config: the config
+// path attached as istio metadata (e.g. to routes), and the RBAC policy name prefix of authorization policies.
+func configReferences(gvk schema.GroupVersionKind, name, namespace string) []string {
+	return []string{
+		"/apis/" + gvk.Group + "/" + gvk.Version + "/namespaces/" + namespace + "/" +
+			strcase.CamelCaseToKebabCase(gvk.Kind) + "/" + name,
+		fmt.Sprintf("ns[%s]-policy[%s]", namespace, name),
+	}
+}
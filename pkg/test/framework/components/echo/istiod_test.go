@@ -0,0 +1,140 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	securityv1beta1 "istio.io/api/security/v1beta1"
+	"istio.io/api/type/v1beta1"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/network"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/util/protomarshal"
+)
+
+func TestSelectedConfig(t *testing.T) {
+	created := time.Now()
+	entry := func(name, ns string, spec *securityv1beta1.PeerAuthentication) configzEntry {
+		js, err := protomarshal.Marshal(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := configzEntry{
+			APIVersion: "security.istio.io/v1beta1",
+			Kind:       "PeerAuthentication",
+			Spec:       json.RawMessage(js),
+		}
+		e.Metadata.Name = name
+		e.Metadata.Namespace = ns
+		// Each entry is newer than the last.
+		created = created.Add(time.Second)
+		e.Metadata.CreationTimestamp = metav1.NewTime(created)
+		return e
+	}
+	mode := func(m securityv1beta1.PeerAuthentication_MutualTLS_Mode) *securityv1beta1.PeerAuthentication {
+		return &securityv1beta1.PeerAuthentication{Mtls: &securityv1beta1.PeerAuthentication_MutualTLS{Mode: m}}
+	}
+	withSelector := func(pa *securityv1beta1.PeerAuthentication, app string) *securityv1beta1.PeerAuthentication {
+		pa.Selector = &v1beta1.WorkloadSelector{MatchLabels: map[string]string{"app": app}}
+		return pa
+	}
+	mesh := entry("mesh", "istio-system", mode(securityv1beta1.PeerAuthentication_MutualTLS_STRICT))
+	ns := entry("ns", "echo1", mode(securityv1beta1.PeerAuthentication_MutualTLS_PERMISSIVE))
+	nsNewer := entry("ns-newer", "echo1", mode(securityv1beta1.PeerAuthentication_MutualTLS_STRICT))
+	workload := entry("a", "echo1", withSelector(mode(securityv1beta1.PeerAuthentication_MutualTLS_DISABLE), "a"))
+	otherWorkload := entry("b", "echo1", withSelector(mode(securityv1beta1.PeerAuthentication_MutualTLS_STRICT), "b"))
+	otherNamespace := entry("other", "echo2", mode(securityv1beta1.PeerAuthentication_MutualTLS_DISABLE))
+
+	cfg := Config{Service: "a", Namespace: namespace.Static("echo1"), Subsets: []SubsetConfig{{Version: "v1"}}}
+	cases := []struct {
+		name     string
+		configs  []configzEntry
+		expected proto.Message
+	}{
+		{"none", nil, nil},
+		{"other namespace", []configzEntry{otherNamespace}, nil},
+		{"mesh", []configzEntry{otherNamespace, mesh}, mode(securityv1beta1.PeerAuthentication_MutualTLS_STRICT)},
+		{"namespace", []configzEntry{mesh, nsNewer, ns}, mode(securityv1beta1.PeerAuthentication_MutualTLS_PERMISSIVE)},
+		{
+			"workload",
+			[]configzEntry{mesh, ns, otherWorkload, workload},
+			withSelector(mode(securityv1beta1.PeerAuthentication_MutualTLS_DISABLE), "a"),
+		},
+		{"other workload", []configzEntry{otherWorkload, mesh}, mode(securityv1beta1.PeerAuthentication_MutualTLS_STRICT)},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectedConfig(tt.configs, gvk.PeerAuthentication.Kubernetes(), "istio-system", cfg,
+				func() proto.Message {
+					return &securityv1beta1.PeerAuthentication{}
+				}, func(m proto.Message) map[string]string {
+					return m.(*securityv1beta1.PeerAuthentication).GetSelector().GetMatchLabels()
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expected == nil {
+				if got != nil {
+					t.Fatalf("expected no config, got %v", got)
+				}
+				return
+			}
+			if !proto.Equal(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHasNetworkGateway(t *testing.T) {
+	gateways, err := json.Marshal([]model.NetworkGateway{
+		{Network: "n1", Cluster: "cls1", Addr: "10.0.0.1", Port: 15443},
+		{Network: "n2", Cluster: "cls2", Addr: "10.0.0.2", Port: 15443},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		networkz string
+		network  network.ID
+		expected bool
+	}{
+		{string(gateways), "n2", true},
+		{string(gateways), "n3", false},
+		{"null", "n1", false},
+		{"[]", "n1", false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.networkz+"/"+string(tt.network), func(t *testing.T) {
+			got, err := hasNetworkGateway(tt.networkz, tt.network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+	if _, err := hasNetworkGateway("not json", "n1"); err == nil {
+		t.Fatal("expected invalid output to be rejected")
+	}
+}
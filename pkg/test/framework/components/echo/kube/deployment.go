@@ -30,6 +30,7 @@ import (
 	kubeCore "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 
 	"istio.io/api/label"
@@ -62,6 +63,27 @@ metadata:
   name: {{ .Service }}
 ---
 {{- end }}
+{{- if .DNSRegistered }}
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: {{ .Service }}
+spec:
+  hosts:
+  - {{ .ServiceHost }}
+  location: MESH_INTERNAL
+  resolution: STATIC
+  ports:
+{{- range $i, $p := .ServicePorts }}
+  - name: {{ $p.Name }}
+    number: {{ $p.ServicePort }}
+    protocol: {{ $p.Protocol }}
+    targetPort: {{ $p.WorkloadPort }}
+{{- end }}
+  workloadSelector:
+    labels:
+      app: {{ .Service }}
+{{- else }}
 apiVersion: v1
 kind: Service
 metadata:
@@ -89,9 +111,16 @@ spec:
   - name: {{ $p.Name }}
     port: {{ $p.ServicePort }}
     targetPort: {{ $p.WorkloadPort }}
+{{- if $p.HTTP3 }}
+  - name: {{ $p.Name }}-udp
+    port: {{ $p.ServicePort }}
+    targetPort: {{ $p.WorkloadPort }}
+    protocol: UDP
+{{- end }}
 {{- end }}
   selector:
     app: {{ .Service }}
+{{- end }}
 `
 
 	deploymentYAML = `
@@ -130,6 +159,9 @@ spec:
         app: {{ $.Service }}
         version: {{ $subset.Version }}
         test.istio.io/class: {{ $.WorkloadClass }}
+{{- if $.AmbientMode }}
+        istio.io/dataplane-mode: ambient
+{{- end }}
 {{- if $.Compatibility }}
         istio.io/rev: {{ $revision }}
 {{- end }}
@@ -195,6 +227,9 @@ spec:
 {{- if $p.TLS }}
           - --tls={{ $p.Port }}
 {{- end }}
+{{- if $p.HTTP3 }}
+          - --http3={{ $p.Port }}
+{{- end }}
 {{- if $p.ServerFirst }}
           - --server-first={{ $p.Port }}
 {{- end }}
@@ -209,6 +244,16 @@ spec:
           - "{{ $subset.Version }}"
           - --istio-version
           - "{{ $version }}"
+{{- if $.ConnectProxy }}
+          - --connect-proxy
+{{- end }}
+{{- if $.ErrorRate }}
+          - --error-rate={{ $.ErrorRate }}
+{{- end }}
+{{- if $.DelayPercentage }}
+          - --delay-percentage={{ $.DelayPercentage }}
+          - --delay-duration={{ $.DelayDuration }}
+{{- end }}
 {{- if $.TLSSettings }}
           - --crt=/etc/certs/custom/cert-chain.pem
           - --key=/etc/certs/custom/key.pem
@@ -225,6 +270,10 @@ spec:
 {{- if eq .Port 3333 }}
           name: tcp-health-port
 {{- end }}
+{{- if $p.HTTP3 }}
+        - containerPort: {{ $p.Port }}
+          protocol: UDP
+{{- end }}
 {{- end }}
         env:
         - name: INSTANCE_IP
@@ -394,12 +443,25 @@ spec:
 {{- if $p.TLS }}
              --tls={{ $p.Port }} \
 {{- end }}
+{{- if $p.HTTP3 }}
+             --http3={{ $p.Port }} \
+{{- end }}
 {{- if $p.InstanceIP }}
              --bind-ip={{ $p.Port }} \
 {{- end }}
 {{- if $p.LocalhostIP }}
              --bind-localhost={{ $p.Port }} \
 {{- end }}
+{{- end }}
+{{- if $.ConnectProxy }}
+             --connect-proxy \
+{{- end }}
+{{- if $.ErrorRate }}
+             --error-rate={{ $.ErrorRate }} \
+{{- end }}
+{{- if $.DelayPercentage }}
+             --delay-percentage={{ $.DelayPercentage }} \
+             --delay-duration={{ $.DelayDuration }} \
 {{- end }}
              --crt=/var/lib/istio/cert.crt \
              --key=/var/lib/istio/cert.key
@@ -509,12 +571,7 @@ func newDeployment(ctx resource.Context, cfg echo.Config) (*deployment, error) {
 // `kubectl rollout status` to complete before returning.
 func (d *deployment) Restart() error {
 	var errs error
-	var deploymentNames []string
-	for _, s := range d.cfg.Subsets {
-		// TODO(Monkeyanator) move to common place so doesn't fall out of sync with templates
-		deploymentNames = append(deploymentNames, fmt.Sprintf("%s-%s", d.cfg.Service, s.Version))
-	}
-	for _, deploymentName := range deploymentNames {
+	for _, deploymentName := range d.deploymentNames() {
 		wlType := "deployment"
 		if d.cfg.IsStatefulSet() {
 			wlType = "statefulset"
@@ -536,6 +593,81 @@ func (d *deployment) Restart() error {
 	return errs
 }
 
+// deploymentNames returns the names of the Deployments (or StatefulSets) for each subset.
+func (d *deployment) deploymentNames() []string {
+	var deploymentNames []string
+	for _, s := range d.cfg.Subsets {
+		// TODO(Monkeyanator) move to common place so doesn't fall out of sync with templates
+		deploymentNames = append(deploymentNames, fmt.Sprintf("%s-%s", d.cfg.Service, s.Version))
+	}
+	return deploymentNames
+}
+
+// Scale sets the replica count of the Deployment (or StatefulSet) for each subset and waits for the
+// rollout to complete, or for the context to be done.
+func (d *deployment) Scale(ctx context.Context, replicas int) error {
+	ns := d.cfg.Namespace.Name()
+	for _, name := range d.deploymentNames() {
+		if err := d.updateScale(ctx, name, int32(replicas)); err != nil {
+			return fmt.Errorf("failed to scale %s/%s: %v", ns, name, err)
+		}
+	}
+	for _, name := range d.deploymentNames() {
+		err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+			return d.scaled(ctx, name, int32(replicas))
+		}, ctx.Done())
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return fmt.Errorf("failed waiting for %s/%s to scale to %d replicas: %v", ns, name, replicas, err)
+		}
+	}
+	return nil
+}
+
+func (d *deployment) updateScale(ctx context.Context, name string, replicas int32) error {
+	ns := d.cfg.Namespace.Name()
+	if d.cfg.IsStatefulSet() {
+		s, err := d.cfg.Cluster.AppsV1().StatefulSets(ns).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		s.Spec.Replicas = replicas
+		_, err = d.cfg.Cluster.AppsV1().StatefulSets(ns).UpdateScale(ctx, name, s, metav1.UpdateOptions{})
+		return err
+	}
+	s, err := d.cfg.Cluster.AppsV1().Deployments(ns).GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	s.Spec.Replicas = replicas
+	_, err = d.cfg.Cluster.AppsV1().Deployments(ns).UpdateScale(ctx, name, s, metav1.UpdateOptions{})
+	return err
+}
+
+// scaled returns true once the rollout to the given number of replicas has completed.
+func (d *deployment) scaled(ctx context.Context, name string, replicas int32) (bool, error) {
+	ns := d.cfg.Namespace.Name()
+	if d.cfg.IsStatefulSet() {
+		s, err := d.cfg.Cluster.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return s.Status.ObservedGeneration >= s.Generation &&
+			s.Status.Replicas == replicas &&
+			s.Status.ReadyReplicas == replicas, nil
+	}
+	dep, err := d.cfg.Cluster.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return dep.Status.ObservedGeneration >= dep.Generation &&
+		dep.Status.Replicas == replicas &&
+		dep.Status.UpdatedReplicas == replicas &&
+		dep.Status.AvailableReplicas == replicas, nil
+}
+
 func (d *deployment) WorkloadReady(w *workload) {
 	if !d.shouldCreateWLE {
 		return
@@ -653,7 +785,10 @@ func templateParams(cfg echo.Config, settings *resource.Settings) (map[string]in
 		"Service":             cfg.Service,
 		"Version":             cfg.Version,
 		"Headless":            cfg.Headless,
+		"DNSRegistered":       cfg.DNSRegistered,
+		"ServiceHost":         cfg.ClusterLocalFQDN(),
 		"StatefulSet":         cfg.StatefulSet,
+		"AmbientMode":         cfg.AmbientMode,
 		"ProxylessGRPC":       cfg.IsProxylessGRPC(),
 		"GRPCMagicPort":       grpcMagicPort,
 		"Locality":            cfg.Locality,
@@ -672,6 +807,10 @@ func templateParams(cfg echo.Config, settings *resource.Settings) (map[string]in
 		},
 		"StartupProbe":      supportStartupProbe,
 		"IncludeExtAuthz":   cfg.IncludeExtAuthz,
+		"ConnectProxy":      cfg.ConnectProxy,
+		"ErrorRate":         cfg.ErrorRate,
+		"DelayPercentage":   cfg.DelayPercentage,
+		"DelayDuration":     cfg.DelayDuration,
 		"Revisions":         settings.Revisions.TemplateMap(),
 		"Compatibility":     settings.Compatibility,
 		"WorkloadClass":     cfg.WorkloadClass(),
@@ -916,6 +1055,7 @@ func getContainerPorts(cfg echo.Config) echoCommon.PortList {
 			Protocol:    p.Protocol,
 			Port:        p.WorkloadPort,
 			TLS:         p.TLS,
+			HTTP3:       p.HTTP3,
 			ServerFirst: p.ServerFirst,
 			InstanceIP:  p.InstanceIP,
 			LocalhostIP: p.LocalhostIP,
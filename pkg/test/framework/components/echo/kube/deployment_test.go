@@ -15,6 +15,7 @@ package kube
 
 import (
 	"testing"
+	"time"
 
 	testutil "istio.io/istio/pilot/test/util"
 	"istio.io/istio/pkg/config/protocol"
@@ -49,6 +50,58 @@ func TestDeploymentYAML(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:         "dns-registered",
+			wantFilePath: "testdata/dns-registered.yaml",
+			config: echo.Config{
+				Service:       "foo",
+				DNSRegistered: true,
+				Ports: []echo.Port{
+					{
+						Name:         "http",
+						Protocol:     protocol.HTTP,
+						WorkloadPort: 8090,
+						ServicePort:  8090,
+					},
+				},
+			},
+		},
+		{
+			name:         "connect-proxy",
+			wantFilePath: "testdata/connect-proxy.yaml",
+			config: echo.Config{
+				Service:      "foo",
+				Version:      "bar",
+				ConnectProxy: true,
+				Ports: []echo.Port{
+					{
+						Name:         "http",
+						Protocol:     protocol.HTTP,
+						WorkloadPort: 8090,
+						ServicePort:  8090,
+					},
+				},
+			},
+		},
+		{
+			name:         "fault-injection",
+			wantFilePath: "testdata/fault-injection.yaml",
+			config: echo.Config{
+				Service:         "foo",
+				Version:         "bar",
+				ErrorRate:       0.25,
+				DelayPercentage: 50,
+				DelayDuration:   200 * time.Millisecond,
+				Ports: []echo.Port{
+					{
+						Name:         "http",
+						Protocol:     protocol.HTTP,
+						WorkloadPort: 8090,
+						ServicePort:  8090,
+					},
+				},
+			},
+		},
 		{
 			name:         "two-workloads-one-nosidecar",
 			wantFilePath: "testdata/two-workloads-one-nosidecar.yaml",
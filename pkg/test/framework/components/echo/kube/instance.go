@@ -44,6 +44,7 @@ const (
 
 var (
 	_ echo.Instance = &instance{}
+	_ echo.Scaler   = &instance{}
 	_ io.Closer     = &instance{}
 
 	startDelay = retry.BackoffDelay(time.Millisecond * 100)
@@ -85,23 +86,26 @@ func newInstance(ctx resource.Context, originalCfg echo.Config) (out *instance,
 	// that it will be closed when it goes out of scope.
 	c.id = ctx.TrackResource(c)
 
-	// Now retrieve the service information to find the ClusterIP
-	s, err := c.cluster.CoreV1().Services(cfg.Namespace.Name()).Get(context.TODO(), cfg.Service, metav1.GetOptions{})
-	if err != nil {
-		return nil, err
-	}
+	// Now retrieve the service information to find the ClusterIP. DNS registered services have no
+	// Service, and so no ClusterIP.
+	if !cfg.DNSRegistered {
+		s, err := c.cluster.CoreV1().Services(cfg.Namespace.Name()).Get(context.TODO(), cfg.Service, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
 
-	c.clusterIP = s.Spec.ClusterIP
-	c.clusterIPs = s.Spec.ClusterIPs
-	switch c.clusterIP {
-	case kubeCore.ClusterIPNone, "":
-		if !cfg.Headless {
-			return nil, fmt.Errorf("invalid ClusterIP %s for non-headless service %s/%s",
-				c.clusterIP,
-				c.cfg.Namespace.Name(),
-				c.cfg.Service)
+		c.clusterIP = s.Spec.ClusterIP
+		c.clusterIPs = s.Spec.ClusterIPs
+		switch c.clusterIP {
+		case kubeCore.ClusterIPNone, "":
+			if !cfg.Headless {
+				return nil, fmt.Errorf("invalid ClusterIP %s for non-headless service %s/%s",
+					c.clusterIP,
+					c.cfg.Namespace.Name(),
+					c.cfg.Service)
+			}
+			c.clusterIP = ""
 		}
-		c.clusterIP = ""
 	}
 
 	// Start the workload manager.
@@ -221,6 +225,38 @@ func (c *instance) Restart() error {
 	}, retry.Timeout(c.cfg.ReadinessTimeout), startDelay)
 }
 
+func (c *instance) ExecCommand(ctx context.Context, container string, cmd ...string) (string, string, error) {
+	workloads, err := c.Workloads()
+	if err != nil {
+		return "", "", err
+	}
+	if len(workloads) == 0 {
+		return "", "", fmt.Errorf("no ready workloads for echo %s/%s", c.cfg.Namespace.Name(), c.cfg.Service)
+	}
+	w := workloads[0].(*workload)
+
+	// The exec itself can't be cancelled, but there's no need to keep the caller waiting.
+	type result struct {
+		stdout, stderr string
+		err            error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stdout, stderr, err := w.cluster.PodExecCommands(w.PodName(), c.cfg.Namespace.Name(), container, cmd)
+		done <- result{stdout: stdout, stderr: stderr, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.stdout, r.stderr, r.err
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+func (c *instance) Scale(ctx context.Context, replicas int) error {
+	return c.deployment.Scale(ctx, replicas)
+}
+
 // aggregateResponses forwards an echo request from all workloads belonging to this echo instance and aggregates the results.
 func (c *instance) aggregateResponses(opts echo.CallOptions) (echoClient.Responses, error) {
 	// TODO put this somewhere else, or require users explicitly set the protocol - quite hacky
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -91,6 +92,15 @@ func (s *sidecar) Config() (*envoyAdmin.ConfigDump, error) {
 	return msg, nil
 }
 
+func (s *sidecar) ResourceConfig(resource string) (*envoyAdmin.ConfigDump, error) {
+	msg := &envoyAdmin.ConfigDump{}
+	if err := s.adminRequest("config_dump?resource="+url.QueryEscape(resource), msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
 func (s *sidecar) ConfigOrFail(t test.Failer) *envoyAdmin.ConfigDump {
 	t.Helper()
 	cfg, err := s.Config()
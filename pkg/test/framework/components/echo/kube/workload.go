@@ -151,6 +151,10 @@ func (w *workload) Sidecar() echo.Sidecar {
 	w.mutex.Lock()
 	s := w.sidecar
 	w.mutex.Unlock()
+	if s == nil {
+		// Avoid returning a non-nil interface holding a nil pointer.
+		return nil
+	}
 	return s
 }
 
@@ -85,17 +85,20 @@ func Namespace(namespace string) Matcher {
 	}
 }
 
-// Cluster matches instances deployed on the given cluster.
+// Cluster matches instances deployed on the given cluster. Instances that are not deployed to a cluster, such as an
+// echo.ExternalService, never match.
 func Cluster(c cluster.Cluster) Matcher {
 	return func(i echo.Instance) bool {
-		return c.Name() == i.Config().Cluster.Name()
+		ic := i.Config().Cluster
+		return ic != nil && c.Name() == ic.Name()
 	}
 }
 
-// Network matches instances deployed in the given network.
+// Network matches instances deployed in the given network. Instances that are not deployed to a cluster never match.
 func Network(n string) Matcher {
 	return func(i echo.Instance) bool {
-		return i.Config().Cluster.NetworkName() == n
+		ic := i.Config().Cluster
+		return ic != nil && ic.NetworkName() == n
 	}
 }
 
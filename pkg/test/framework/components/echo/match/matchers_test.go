@@ -15,6 +15,7 @@
 package match_test
 
 import (
+	"context"
 	"strconv"
 	"testing"
 
@@ -92,6 +93,28 @@ func TestNaked(t *testing.T) {
 	}
 }
 
+func TestClusterAndNetwork(t *testing.T) {
+	// An external service is not deployed to any cluster, so it never matches.
+	external := echo.NewExternalService(namespace.Static("echo"), "api.example.com", "10.0.0.1", nil)
+	tests := []struct {
+		app    echo.Instance
+		expect bool
+	}{
+		{app: a1, expect: true},
+		{app: external, expect: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.app.Config().Service, func(t *testing.T) {
+			if got := match.Cluster(cls1)(tt.app); got != tt.expect {
+				t.Errorf("Cluster: got %v expected %v", got, tt.expect)
+			}
+			if got := match.Network("n1")(tt.app); got != tt.expect {
+				t.Errorf("Network: got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
 var _ echo.Instance = fakeInstance{}
 
 // fakeInstance wraps echo.Config for test-framework internals tests where we don't actually make calls
@@ -154,3 +177,7 @@ func (f fakeInstance) CallOrFail(test.Failer, echo.CallOptions) echoClient.Respo
 func (f fakeInstance) Restart() error {
 	panic("implement me")
 }
+
+func (f fakeInstance) ExecCommand(context.Context, string, ...string) (string, string, error) {
+	panic("implement me")
+}
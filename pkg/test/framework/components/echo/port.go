@@ -49,6 +49,10 @@ type Port struct {
 	// ServerFirst determines whether the port will use server first communication, meaning the client will not send the first byte.
 	ServerFirst bool
 
+	// HTTP3 determines whether the port will additionally serve HTTP/3 over QUIC (UDP) on the same port number.
+	// Only supported for HTTP ports with TLS enabled.
+	HTTP3 bool
+
 	// InstanceIP determines if echo will listen on the instance IP; otherwise, it will listen on wildcard
 	InstanceIP bool
 
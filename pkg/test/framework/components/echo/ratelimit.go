@@ -0,0 +1,192 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"strings"
+	"time"
+
+	udpa "github.com/cncf/xds/go/udpa/type/v1"
+	xdstype "github.com/cncf/xds/go/xds/type/v3"
+	envoyAdmin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	localratelimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	localRateLimitFilter  = "envoy.filters.http.local_ratelimit"
+	localRateLimitTypeURL = "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit"
+	// inboundRoutePrefix is the prefix of the names of the route configs for inbound traffic.
+	inboundRoutePrefix = "inbound|"
+)
+
+// localRateLimitBuckets returns the token buckets of the local rate limits that apply to traffic in the given
+// direction in the config dump, both those of the local rate limit HTTP filters in the listeners and those configured
+// per virtual host or route. For outbound traffic, only the virtual hosts with a domain for host are considered.
+// Local rate limits without a token bucket, such as a filter that only enables per-route limits, are skipped.
+func localRateLimitBuckets(dump *envoyAdmin.ConfigDump, direction core.TrafficDirection, host string) ([]*envoytype.TokenBucket, error) {
+	var out []*envoytype.TokenBucket
+	add := func(a *anypb.Any) error {
+		rl, err := localRateLimit(a)
+		if err != nil {
+			return err
+		}
+		if rl.GetTokenBucket() != nil {
+			out = append(out, rl.GetTokenBucket())
+		}
+		return nil
+	}
+	for _, c := range dump.Configs {
+		listeners := &envoyAdmin.ListenersConfigDump{}
+		routes := &envoyAdmin.RoutesConfigDump{}
+		switch {
+		case c.MessageIs(listeners):
+			if err := c.UnmarshalTo(listeners); err != nil {
+				return nil, err
+			}
+			for _, dl := range listeners.DynamicListeners {
+				if dl.GetActiveState().GetListener() == nil {
+					continue
+				}
+				l := &listener.Listener{}
+				if err := dl.ActiveState.Listener.UnmarshalTo(l); err != nil {
+					return nil, err
+				}
+				if l.TrafficDirection != direction {
+					continue
+				}
+				for _, fc := range l.FilterChains {
+					for _, f := range fc.Filters {
+						if f.Name != wellknown.HTTPConnectionManager || f.GetTypedConfig() == nil {
+							continue
+						}
+						h := &hcm.HttpConnectionManager{}
+						if err := f.GetTypedConfig().UnmarshalTo(h); err != nil {
+							return nil, err
+						}
+						for _, hf := range h.HttpFilters {
+							if hf.Name != localRateLimitFilter || hf.GetTypedConfig() == nil {
+								continue
+							}
+							if err := add(hf.GetTypedConfig()); err != nil {
+								return nil, err
+							}
+						}
+					}
+				}
+			}
+		case c.MessageIs(routes):
+			if err := c.UnmarshalTo(routes); err != nil {
+				return nil, err
+			}
+			for _, dr := range routes.DynamicRouteConfigs {
+				if dr.GetRouteConfig() == nil {
+					continue
+				}
+				rc := &route.RouteConfiguration{}
+				if err := dr.RouteConfig.UnmarshalTo(rc); err != nil {
+					return nil, err
+				}
+				if inbound := strings.HasPrefix(rc.Name, inboundRoutePrefix); inbound != (direction == core.TrafficDirection_INBOUND) {
+					continue
+				}
+				for _, vh := range rc.VirtualHosts {
+					if direction == core.TrafficDirection_OUTBOUND && !hasDomain(vh.Domains, host) {
+						continue
+					}
+					if a := vh.TypedPerFilterConfig[localRateLimitFilter]; a != nil {
+						if err := add(a); err != nil {
+							return nil, err
+						}
+					}
+					for _, r := range vh.Routes {
+						if a := r.TypedPerFilterConfig[localRateLimitFilter]; a != nil {
+							if err := add(a); err != nil {
+								return nil, err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// localRateLimit unmarshals a local rate limit config, which EnvoyFilters commonly set as a TypedStruct.
+func localRateLimit(a *anypb.Any) (*localratelimit.LocalRateLimit, error) {
+	out := &localratelimit.LocalRateLimit{}
+	var value *structpb.Struct
+	udpaStruct, xdsStruct := &udpa.TypedStruct{}, &xdstype.TypedStruct{}
+	switch {
+	case a.MessageIs(udpaStruct):
+		if err := a.UnmarshalTo(udpaStruct); err != nil {
+			return nil, err
+		}
+		if udpaStruct.TypeUrl != localRateLimitTypeURL {
+			return out, nil
+		}
+		value = udpaStruct.Value
+	case a.MessageIs(xdsStruct):
+		if err := a.UnmarshalTo(xdsStruct); err != nil {
+			return nil, err
+		}
+		if xdsStruct.TypeUrl != localRateLimitTypeURL {
+			return out, nil
+		}
+		value = xdsStruct.Value
+	case a.MessageIs(out):
+		return out, a.UnmarshalTo(out)
+	default:
+		return out, nil
+	}
+	js, err := protojson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return out, protojson.Unmarshal(js, out)
+}
+
+// hasDomain returns true if the virtual host domains include host, with or without a port.
+func hasDomain(domains []string, host string) bool {
+	for _, d := range domains {
+		if d == host || strings.HasPrefix(d, host+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// admittedRequests returns the number of requests the token bucket admits within the given window, starting full.
+func admittedRequests(bucket *envoytype.TokenBucket, window time.Duration) int {
+	admitted := int(bucket.GetMaxTokens())
+	interval := bucket.GetFillInterval().AsDuration()
+	if interval <= 0 {
+		return admitted
+	}
+	perFill := 1
+	if bucket.GetTokensPerFill() != nil {
+		perFill = int(bucket.GetTokensPerFill().GetValue())
+	}
+	return admitted + perFill*int(window/interval)
+}
@@ -0,0 +1,165 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+	"time"
+
+	udpa "github.com/cncf/xds/go/udpa/type/v1"
+	envoyAdmin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	localratelimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestLocalRateLimitBuckets(t *testing.T) {
+	bucket := func(max uint32) *envoytype.TokenBucket {
+		return &envoytype.TokenBucket{MaxTokens: max, FillInterval: durationpb.New(time.Minute)}
+	}
+	typedStruct := func(max float64) *anypb.Any {
+		value, err := structpb.NewStruct(map[string]interface{}{
+			"stat_prefix":  "http_local_rate_limiter",
+			"token_bucket": map[string]interface{}{"max_tokens": max, "fill_interval": "60s"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return toAny(t, &udpa.TypedStruct{TypeUrl: localRateLimitTypeURL, Value: value})
+	}
+	listenerWith := func(direction core.TrafficDirection, filter *anypb.Any) *anypb.Any {
+		manager := &hcm.HttpConnectionManager{HttpFilters: []*hcm.HttpFilter{
+			{Name: localRateLimitFilter, ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: filter}},
+			{Name: "envoy.filters.http.router"},
+		}}
+		return toAny(t, &listener.Listener{TrafficDirection: direction, FilterChains: []*listener.FilterChain{{
+			Filters: []*listener.Filter{{
+				Name:       wellknown.HTTPConnectionManager,
+				ConfigType: &listener.Filter_TypedConfig{TypedConfig: toAny(t, manager)},
+			}},
+		}}})
+	}
+	perFilter := func(max uint32) map[string]*anypb.Any {
+		return map[string]*anypb.Any{
+			localRateLimitFilter: toAny(t, &localratelimit.LocalRateLimit{StatPrefix: "rl", TokenBucket: bucket(max)}),
+		}
+	}
+	dump := &envoyAdmin.ConfigDump{Configs: []*anypb.Any{
+		toAny(t, &envoyAdmin.ListenersConfigDump{
+			DynamicListeners: []*envoyAdmin.ListenersConfigDump_DynamicListener{
+				{ActiveState: &envoyAdmin.ListenersConfigDump_DynamicListenerState{
+					Listener: listenerWith(core.TrafficDirection_INBOUND, typedStruct(10)),
+				}},
+				{ActiveState: &envoyAdmin.ListenersConfigDump_DynamicListenerState{
+					Listener: listenerWith(core.TrafficDirection_OUTBOUND, typedStruct(20)),
+				}},
+				// A filter without a token bucket only enables the per route limits.
+				{ActiveState: &envoyAdmin.ListenersConfigDump_DynamicListenerState{
+					Listener: listenerWith(core.TrafficDirection_INBOUND, toAny(t, &localratelimit.LocalRateLimit{StatPrefix: "rl"})),
+				}},
+			},
+		}),
+		toAny(t, &envoyAdmin.RoutesConfigDump{
+			DynamicRouteConfigs: []*envoyAdmin.RoutesConfigDump_DynamicRouteConfig{
+				{RouteConfig: toAny(t, &route.RouteConfiguration{Name: "inbound|8080||", VirtualHosts: []*route.VirtualHost{
+					{Name: "inbound|http|80", Domains: []string{"*"}, TypedPerFilterConfig: perFilter(30)},
+				}})},
+				{RouteConfig: toAny(t, &route.RouteConfiguration{Name: "80", VirtualHosts: []*route.VirtualHost{
+					{
+						Name:    "b.echo.svc.cluster.local:80",
+						Domains: []string{"b.echo.svc.cluster.local", "b.echo.svc.cluster.local:80"},
+						Routes:  []*route.Route{{Name: "default", TypedPerFilterConfig: perFilter(40)}},
+					},
+					{Name: "c.echo.svc.cluster.local:80", Domains: []string{"c.echo.svc.cluster.local"}, TypedPerFilterConfig: perFilter(50)},
+				}})},
+			},
+		}),
+	}}
+
+	cases := []struct {
+		name      string
+		direction core.TrafficDirection
+		host      string
+		want      []uint32
+	}{
+		{name: "inbound", direction: core.TrafficDirection_INBOUND, want: []uint32{10, 30}},
+		{name: "outbound to b", direction: core.TrafficDirection_OUTBOUND, host: "b.echo.svc.cluster.local", want: []uint32{20, 40}},
+		{name: "outbound to c", direction: core.TrafficDirection_OUTBOUND, host: "c.echo.svc.cluster.local", want: []uint32{20, 50}},
+		{name: "outbound to other", direction: core.TrafficDirection_OUTBOUND, host: "d.echo.svc.cluster.local", want: []uint32{20}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buckets, err := localRateLimitBuckets(dump, tc.direction, tc.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint32
+			for _, b := range buckets {
+				got = append(got, b.GetMaxTokens())
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got max tokens %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("got max tokens %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmittedRequests(t *testing.T) {
+	cases := []struct {
+		name   string
+		bucket *envoytype.TokenBucket
+		want   int
+	}{
+		{
+			name:   "no refill within the window",
+			bucket: &envoytype.TokenBucket{MaxTokens: 1, FillInterval: durationpb.New(10 * time.Minute)},
+			want:   1,
+		},
+		{
+			name:   "default tokens per fill",
+			bucket: &envoytype.TokenBucket{MaxTokens: 10, FillInterval: durationpb.New(30 * time.Second)},
+			want:   12,
+		},
+		{
+			name: "tokens per fill",
+			bucket: &envoytype.TokenBucket{
+				MaxTokens:     10,
+				TokensPerFill: wrapperspb.UInt32(5),
+				FillInterval:  durationpb.New(10 * time.Second),
+			},
+			want: 40,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := admittedRequests(tc.bucket, time.Minute); got != tc.want {
+				t.Fatalf("got %d admitted requests, want %d", got, tc.want)
+			}
+		})
+	}
+}
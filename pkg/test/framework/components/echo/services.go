@@ -15,10 +15,52 @@
 package echo
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	envoyAdmin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/protobuf/proto"
+	kubeCore "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"istio.io/api/annotation"
+	securityv1beta1 "istio.io/api/security/v1beta1"
+	telemetry "istio.io/api/telemetry/v1alpha1"
+	networkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/cluster"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/http/headers"
+	"istio.io/istio/pkg/network"
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/echo/check"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/test/scopes"
+	"istio.io/istio/pkg/util/protomarshal"
 )
 
 // Services is a set of Instances that share the same FQDN. While an Instance contains
@@ -28,16 +70,59 @@ type Services []Instances
 
 // GetByService finds the first Instances with the given Service name. It is possible to have multiple deployments
 // with the same service name but different namespaces (and therefore different FQDNs). Use caution when relying on
-// Service.
+// Service. A warning is logged if more than one deployment matches; use GetAllByService to get every match.
+// Like Kubernetes Service names, the name is case-insensitive.
 func (d Services) GetByService(service string) Target {
+	matches := d.GetAllByService(service)
+	if len(matches) == 0 {
+		return nil
+	}
+	if len(matches) > 1 {
+		scopes.Framework.Warnf("GetByService(%s) matched %d deployments %v; using %s",
+			service, len(matches), matches.FQDNs(), matches[0].Config().ClusterLocalFQDN())
+	}
+	return matches[0]
+}
+
+// GetAllByService finds all Instances with the given Service name, in order. The name is compared
+// case-insensitively, since Kubernetes Service names are DNS labels.
+func (d Services) GetAllByService(service string) Services {
+	var out Services
+	for _, target := range d {
+		if strings.EqualFold(target.Config().Service, service) {
+			out = append(out, target)
+		}
+	}
+	return out
+}
+
+// GetByFQDN finds the Instances with the given cluster-local FQDN. Unlike GetByService, this is unambiguous since
+// the FQDN includes the namespace. Returns nil if no match is found.
+func (d Services) GetByFQDN(fqdn string) Target {
 	for _, target := range d {
-		if target.Config().Service == service {
+		if target.Config().ClusterLocalFQDN() == fqdn {
 			return target
 		}
 	}
 	return nil
 }
 
+// GetByCrossClusterFQDN finds the instances deployed in the given cluster for the service with the given FQDN.
+// The FQDN may be either the cluster-local or the cluster set (MCS) FQDN. Unlike GetByFQDN, the result only
+// contains instances from the given cluster. Returns nil if no match is found.
+func (d Services) GetByCrossClusterFQDN(fqdn string, c cluster.ID) Target {
+	for _, target := range d {
+		cfg := target.Config()
+		if cfg.ClusterLocalFQDN() != fqdn && cfg.ClusterSetLocalFQDN() != fqdn {
+			continue
+		}
+		if out := instancesInCluster(target, c); len(out) > 0 {
+			return out
+		}
+	}
+	return nil
+}
+
 type ServiceNameList []model.NamespacedName
 
 func (l ServiceNameList) Names() []string {
@@ -49,10 +134,42 @@ func (l ServiceNameList) Names() []string {
 }
 
 func (l ServiceNameList) NamespacedNames() []string {
+	return l.NamespacedNamesWithSep(".")
+}
+
+// NamespacedNamesWithSep is similar to NamespacedNames, but joins name and namespace with the given separator.
+func (l ServiceNameList) NamespacedNamesWithSep(sep string) []string {
 	out := make([]string, 0, len(l))
 	for _, n := range l {
-		out = append(out, n.Name+"."+n.Namespace)
+		out = append(out, n.Name+sep+n.Namespace)
+	}
+	return out
+}
+
+var _ sort.Interface = ServiceNameList{}
+
+// Len returns the number of names
+func (l ServiceNameList) Len() int {
+	return len(l)
+}
+
+// Less orders the names by namespace, then by name.
+func (l ServiceNameList) Less(i, j int) bool {
+	if l[i].Namespace != l[j].Namespace {
+		return l[i].Namespace < l[j].Namespace
 	}
+	return l[i].Name < l[j].Name
+}
+
+// Swap switches the positions of elements at i and j (used for sorting).
+func (l ServiceNameList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// Sorted returns a sorted copy of this list.
+func (l ServiceNameList) Sorted() ServiceNameList {
+	out := append(ServiceNameList{}, l...)
+	sort.Stable(out)
 	return out
 }
 
@@ -65,8 +182,10 @@ func (d Services) ServiceNames() ServiceNameList {
 	return out
 }
 
-// ServiceNamesWithNamespacePrefix is similar to ServiceNames but returns namspaces prefixes rather than the full
-// namespace names. This is useful for test method naming and logs.
+// ServiceNamesWithNamespacePrefix is similar to ServiceNames but returns namespace prefixes (see
+// namespace.Instance.Prefix) rather than the full namespace names. Since prefixes don't include the random suffix of
+// generated namespaces, this is useful for test method naming and logs. The names are sorted, so that the output
+// does not depend on the order the services were deployed in.
 func (d Services) ServiceNamesWithNamespacePrefix() ServiceNameList {
 	var out ServiceNameList
 	for _, target := range d {
@@ -75,6 +194,7 @@ func (d Services) ServiceNamesWithNamespacePrefix() ServiceNameList {
 			Namespace: target.Config().Namespace.Prefix(),
 		})
 	}
+	sort.Stable(out)
 	return out
 }
 
@@ -87,7 +207,37 @@ func (d Services) FQDNs() []string {
 	return out
 }
 
-func (d Services) Instances() Instances {
+// FQDNsForCluster gets the FQDNs of the Services as seen from the given cluster. Services with instances in the
+// cluster use the cluster-local FQDN. Services that are only deployed to other clusters can only be reached through
+// the MCS Cluster Set host, so the cluster set FQDN is returned.
+func (d Services) FQDNsForCluster(c cluster.ID) []string {
+	var out []string
+	for _, target := range d {
+		if len(instancesInCluster(target, c)) > 0 {
+			out = append(out, target.Config().ClusterLocalFQDN())
+		} else {
+			out = append(out, target.Config().ClusterSetLocalFQDN())
+		}
+	}
+	return out
+}
+
+// ToMap returns the Services keyed by cluster-local FQDN, for repeated lookups. Panics if two entries share the
+// same FQDN, which indicates the Services were built incorrectly.
+func (d Services) ToMap() map[string]Instances {
+	out := make(map[string]Instances, len(d))
+	for _, target := range d {
+		fqdn := target.Config().ClusterLocalFQDN()
+		if _, ok := out[fqdn]; ok {
+			panic(fmt.Sprintf("duplicate FQDN %s in Services %v", fqdn, d.FQDNs()))
+		}
+		out[fqdn] = target
+	}
+	return out
+}
+
+// AllInstances returns the instances of all the Services, flattened into a single list.
+func (d Services) AllInstances() Instances {
 	var out Instances
 	for _, target := range d {
 		out = append(out, target.Instances()...)
@@ -95,6 +245,15 @@ func (d Services) Instances() Instances {
 	return out
 }
 
+// Instances returns the instances of all the Services.
+//
+// Deprecated: use AllInstances, which avoids confusion with the Instances type.
+func (d Services) Instances() Instances {
+	return d.AllInstances()
+}
+
+// MatchFQDNs returns the Services whose cluster-local FQDN exactly matches one of the given values. Use
+// MatchFQDNsGlob to match with wildcards.
 func (d Services) MatchFQDNs(fqdns ...string) Services {
 	match := map[string]bool{}
 	for _, fqdn := range fqdns {
@@ -109,6 +268,610 @@ func (d Services) MatchFQDNs(fqdns ...string) Services {
 	return out
 }
 
+// MatchFQDNsGlob is similar to MatchFQDNs, but each pattern may contain wildcards using path.Match syntax. For
+// example, "*.svc.cluster.local" matches any cluster-local FQDN and "reviews.*" matches reviews in any namespace.
+// Patterns without wildcards are compared exactly. An error is returned if any pattern is malformed.
+func (d Services) MatchFQDNsGlob(patterns ...string) (Services, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid FQDN pattern %q: %v", p, err)
+		}
+	}
+	var out Services
+	for _, target := range d {
+		fqdn := target.Config().ClusterLocalFQDN()
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, fqdn); ok {
+				out = append(out, target)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// Filter returns a new Services containing only the Instances for which f returns true. Order is preserved and
+// the result is never nil.
+func (d Services) Filter(f func(Instances) bool) Services {
+	out := Services{}
+	for _, target := range d {
+		if f(target) {
+			out = append(out, target)
+		}
+	}
+	return out
+}
+
+// Partition splits the Services into those for which f returns true and those for which it returns false. Both
+// results are sorted and never nil.
+func (d Services) Partition(f func(Instances) bool) (Services, Services) {
+	matched, unmatched := Services{}, Services{}
+	for _, target := range d {
+		if f(target) {
+			matched = append(matched, target)
+		} else {
+			unmatched = append(unmatched, target)
+		}
+	}
+	sort.Stable(matched)
+	sort.Stable(unmatched)
+	return matched, unmatched
+}
+
+// GroupByNamespace splits the Services by the full namespace name (not the prefix). Each value is sorted.
+func (d Services) GroupByNamespace() map[string]Services {
+	out := map[string]Services{}
+	for _, target := range d {
+		k := target.Config().Namespace.Name()
+		out[k] = append(out[k], target)
+	}
+	for _, v := range out {
+		sort.Stable(v)
+	}
+	return out
+}
+
+// GetByNamespace returns the Services in the namespace with the given full name (not the prefix). The result is
+// never nil.
+func (d Services) GetByNamespace(ns string) Services {
+	return d.Filter(func(target Instances) bool {
+		return target.Config().Namespace.Name() == ns
+	})
+}
+
+// ForNamespace is like GetByNamespace, but takes the namespace.Instance rather than its name.
+func (d Services) ForNamespace(ns namespace.Instance) Services {
+	return d.GetByNamespace(ns.Name())
+}
+
+// GroupByCluster splits the Services by the cluster each Instance is deployed in. Each value contains only the
+// instances from that cluster, and is sorted. Clusters without any instances are not included.
+func (d Services) GroupByCluster() map[cluster.ID]Services {
+	grouped := map[cluster.ID]map[string]Instances{}
+	for _, target := range d.deployed() {
+		for _, instance := range target {
+			c := cluster.ID(instance.Config().Cluster.Name())
+			if grouped[c] == nil {
+				grouped[c] = map[string]Instances{}
+			}
+			fqdn := instance.Config().ClusterLocalFQDN()
+			grouped[c][fqdn] = append(grouped[c][fqdn], instance)
+		}
+	}
+	out := make(map[cluster.ID]Services, len(grouped))
+	for c, byFQDN := range grouped {
+		var services Services
+		for _, instances := range byFQDN {
+			services = append(services, instances)
+		}
+		sort.Stable(services)
+		out[c] = services
+	}
+	return out
+}
+
+// ForCluster returns the Services deployed in the given cluster. Each returned entry contains only the instances
+// from that cluster, even if the original entry spans multiple clusters. The result is never nil.
+func (d Services) ForCluster(c cluster.ID) Services {
+	return d.GetByCluster(c)
+}
+
+// GetByCluster returns the Services deployed in any of the given clusters. Each returned entry contains only the
+// instances from those clusters, even if the original entry spans other clusters as well. The result is never nil.
+func (d Services) GetByCluster(clusters ...cluster.ID) Services {
+	out := Services{}
+	for _, target := range d {
+		if instances := instancesInCluster(target, clusters...); len(instances) > 0 {
+			out = append(out, instances)
+		}
+	}
+	return out
+}
+
+// GetByClusterAndNamespace returns the Services in the namespace with the given full name that are deployed in the
+// given cluster. Each returned entry contains only the instances from that cluster. The result is never nil.
+func (d Services) GetByClusterAndNamespace(c cluster.ID, ns string) Services {
+	return d.GetByNamespace(ns).GetByCluster(c)
+}
+
+// instancesInCluster returns the instances of target deployed in any of the given clusters.
+func instancesInCluster(target Instances, clusters ...cluster.ID) Instances {
+	var out Instances
+	for _, instance := range target {
+		if instance.Config().Cluster == nil {
+			continue
+		}
+		c := cluster.ID(instance.Config().Cluster.Name())
+		for _, want := range clusters {
+			if c == want {
+				out = append(out, instance)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Any returns true if f returns true for at least one of the Services. Returns false if the Services are empty.
+func (d Services) Any(f func(Instances) bool) bool {
+	for _, target := range d {
+		if f(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// All returns true if f returns true for every one of the Services. Returns true if the Services are empty.
+func (d Services) All(f func(Instances) bool) bool {
+	for _, target := range d {
+		if !f(target) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEach calls f for each of the Services in order, stopping at and returning the first non-nil error.
+func (d Services) ForEach(f func(Instances) error) error {
+	for _, target := range d {
+		if err := f(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachCluster calls f once for each cluster with instances in the Services, in order of cluster name, with the
+// Services of that cluster as returned by GroupByCluster. It stops at and returns the first non-nil error.
+func (d Services) ForEachCluster(f func(cluster.ID, Services) error) error {
+	grouped := d.GroupByCluster()
+	clusters := make([]string, 0, len(grouped))
+	for c := range grouped {
+		clusters = append(clusters, string(c))
+	}
+	sort.Strings(clusters)
+	for _, c := range clusters {
+		if err := f(cluster.ID(c), grouped[cluster.ID(c)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// First returns the first of the Services, or false if the Services are empty.
+func (d Services) First() (Instances, bool) {
+	if len(d) == 0 {
+		return nil, false
+	}
+	return d[0], true
+}
+
+// Last returns the last of the Services, or false if the Services are empty.
+func (d Services) Last() (Instances, bool) {
+	if len(d) == 0 {
+		return nil, false
+	}
+	return d[len(d)-1], true
+}
+
+// MustFirst is similar to First, but panics if the Services are empty.
+func (d Services) MustFirst() Instances {
+	out, ok := d.First()
+	if !ok {
+		panic("services are empty")
+	}
+	return out
+}
+
+// Contains returns true if the Services include an entry with the same FQDN as the given target. Comparison is by
+// FQDN rather than identity, since the same service may be represented by different Instances.
+func (d Services) Contains(target Instances) bool {
+	return d.ContainsFQDN(target.Config().ClusterLocalFQDN())
+}
+
+// ContainsFQDN returns true if the Services include an entry with the given cluster-local FQDN.
+func (d Services) ContainsFQDN(fqdn string) bool {
+	for _, target := range d {
+		if target.Config().ClusterLocalFQDN() == fqdn {
+			return true
+		}
+	}
+	return false
+}
+
+// GetByLabel returns the Services that have at least one subset with the given workload label. The result is
+// never nil.
+func (d Services) GetByLabel(key, value string) Services {
+	return d.GetByLabelSelector(labels.SelectorFromSet(labels.Set{key: value}))
+}
+
+// GetByLabelSelector returns the Services that have at least one subset whose workload labels match the
+// selector. The result is never nil.
+func (d Services) GetByLabelSelector(selector labels.Selector) Services {
+	return d.Filter(func(target Instances) bool {
+		for _, l := range target.Config().SubsetLabels() {
+			if selector.Matches(labels.Set(l)) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Sample returns n of the Services chosen at random. The choice is deterministic for a given seed, so that tests
+// are reproducible. Returns a copy of all Services if n >= len(d). Panics if n is negative.
+func (d Services) Sample(n int, seed int64) Services {
+	if n < 0 {
+		panic(fmt.Sprintf("invalid sample size %d", n))
+	}
+	out := d.Copy()
+	if n >= len(out) {
+		return out
+	}
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(out), out.Swap)
+	return out[:n]
+}
+
+// GetByPort returns the Services that expose the given service port. The result is never nil.
+func (d Services) GetByPort(port int) Services {
+	return d.Filter(func(target Instances) bool {
+		for _, p := range target.Config().Ports {
+			if p.ServicePort == port {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// GetByProtocol returns the Services that have at least one port with the given protocol. When given
+// protocol.Unsupported, it returns the Services that have at least one port whose protocol is not
+// recognized. The result is never nil.
+func (d Services) GetByProtocol(p protocol.Instance) Services {
+	return d.Filter(func(target Instances) bool {
+		for _, port := range target.Config().Ports {
+			if port.Protocol == p {
+				return true
+			}
+			if p == protocol.Unsupported && protocol.Parse(string(port.Protocol)) == protocol.Unsupported {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// GetByPortName returns the Services that have a port with the given name. The result is never nil.
+func (d Services) GetByPortName(name string) Services {
+	return d.Filter(func(target Instances) bool {
+		_, found := target.Config().Ports.ForName(name)
+		return found
+	})
+}
+
+// ByVersion returns the Services whose Version, or the version of any of their subsets, matches the given
+// version. If version is empty, a copy of all Services is returned.
+func (d Services) ByVersion(version string) Services {
+	if version == "" {
+		return d.Copy()
+	}
+	return d.Filter(func(target Instances) bool {
+		cfg := target.Config()
+		if cfg.Version == version {
+			return true
+		}
+		for _, s := range cfg.Subsets {
+			if s.Version == version {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// GetByAnnotation returns the Services that have the given service annotation with the given value. If value is
+// empty, any Services with the annotation are returned regardless of its value. The result is never nil.
+func (d Services) GetByAnnotation(key, value string) Services {
+	return d.Filter(func(target Instances) bool {
+		v, found := target.Config().ServiceAnnotations.LookupByName(key)
+		return found && (value == "" || v == value)
+	})
+}
+
+// GetByAnnotationKey returns the Services that have the given service annotation, whatever its value. The result
+// is never nil.
+func (d Services) GetByAnnotationKey(key string) Services {
+	return d.GetByAnnotation(key, "")
+}
+
+// GetByAnnotationAbsent returns the Services that do not have the given service annotation. The result is never
+// nil.
+func (d Services) GetByAnnotationAbsent(key string) Services {
+	return d.Filter(func(target Instances) bool {
+		_, found := target.Config().ServiceAnnotations.LookupByName(key)
+		return !found
+	})
+}
+
+// GetVisibleFrom returns the Services that are visible to workloads in the given namespace, according to the
+// networking.istio.io/exportTo annotation of each service: "*" exports to all namespaces, "." to the service's own
+// namespace, and any other value to the namespace with that name. Services without the annotation are assumed to
+// be exported everywhere, which is the mesh default unless overridden by defaultServiceExportTo. The result is
+// never nil.
+func (d Services) GetVisibleFrom(ns string) Services {
+	return d.Filter(func(target Instances) bool {
+		cfg := target.Config()
+		exportTo, found := cfg.ServiceAnnotations.LookupByName(annotation.NetworkingExportTo.Name)
+		if !found || exportTo == "" {
+			return true
+		}
+		for _, e := range strings.Split(exportTo, ",") {
+			switch e = strings.TrimSpace(e); e {
+			case "*":
+				return true
+			case ".":
+				if cfg.Namespace.Name() == ns {
+					return true
+				}
+			default:
+				if e == ns {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// GetByServiceAccount finds all Services whose workloads run as the given service account. The account can be
+// given as "name@namespace"; a bare name matches that account in each service's own namespace.
+func (d Services) GetByServiceAccount(sa string) Services {
+	name, ns := sa, ""
+	if i := strings.Index(sa, "@"); i >= 0 {
+		name, ns = sa[:i], sa[i+1:]
+	}
+	return d.Filter(func(target Instances) bool {
+		cfg := target.Config()
+		return cfg.ServiceAccountName() == name && (ns == "" || cfg.Namespace.Name() == ns)
+	})
+}
+
+// FilterAmbient returns the Services that are enrolled in ambient mode. See Instances.IsAmbientEnabled.
+func (d Services) FilterAmbient() Services {
+	return d.Filter(Instances.IsAmbientEnabled)
+}
+
+// FilterSidecar returns the Services that are not enrolled in ambient mode.
+func (d Services) FilterSidecar() Services {
+	return d.Filter(func(target Instances) bool {
+		return !target.IsAmbientEnabled()
+	})
+}
+
+// GetByVirtualService finds all Services targeted by the hosts of the VirtualService. Hosts may be FQDNs, wildcard
+// hosts, or short names (e.g. "a" or "a.ns"), which are resolved relative to the namespace of the VirtualService.
+// The host "*" matches all services in the namespace of the VirtualService.
+func (d Services) GetByVirtualService(vs *networkingv1alpha3.VirtualService) Services {
+	return d.Filter(func(target Instances) bool {
+		for _, h := range vs.Spec.Hosts {
+			if matchesHost(target.Config(), h, vs.Namespace) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// GetByDestinationRule finds all Services matched by the host of the DestinationRule. The host is resolved in the
+// same way as the hosts of a VirtualService, see GetByVirtualService.
+func (d Services) GetByDestinationRule(dr *networkingv1alpha3.DestinationRule) Services {
+	return d.Filter(func(target Instances) bool {
+		return matchesHost(target.Config(), dr.Spec.Host, dr.Namespace)
+	})
+}
+
+// FilterBySubset finds the Services matched by the host of the DestinationRule (see GetByDestinationRule) with at
+// least one subset of workloads selected by the labels of the named DestinationRule subset. No services are returned
+// if the DestinationRule has no subset with that name. The result is never nil.
+func (d Services) FilterBySubset(dr *networkingv1alpha3.DestinationRule, subsetName string) Services {
+	var selector labels.Selector
+	for _, subset := range dr.Spec.Subsets {
+		if subset.Name == subsetName {
+			selector = labels.SelectorFromSet(subset.Labels)
+			break
+		}
+	}
+	if selector == nil {
+		return Services{}
+	}
+	return d.GetByDestinationRule(dr).Filter(func(target Instances) bool {
+		for _, l := range target.Config().SubsetLabels() {
+			if selector.Matches(labels.Set(l)) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// matchesHost returns true if the host h of a config in the given namespace refers to the service of cfg.
+func matchesHost(cfg Config, h, namespace string) bool {
+	ns := cfg.Namespace.Name()
+	fqdn := host.Name(cfg.ClusterLocalFQDN())
+	switch {
+	case h == "*":
+		return ns == namespace
+	case host.Name(h).IsWildCarded():
+		return host.Name(h).Matches(fqdn)
+	case h == cfg.Service:
+		return ns == namespace
+	default:
+		return h == cfg.Service+"."+ns || h == cfg.Service+"."+ns+".svc" || host.Name(h) == fqdn
+	}
+}
+
+// ServicePair is a pair of services, as returned by Zip and ZipByFQDN.
+type ServicePair struct {
+	A Instances
+	B Instances
+}
+
+// Zip pairs the services of a and b by position, stopping at the shorter of the two.
+func Zip(a, b Services) []ServicePair {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	out := make([]ServicePair, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, ServicePair{A: a[i], B: b[i]})
+	}
+	return out
+}
+
+// ZipByFQDN pairs the services of a and b by FQDN. Pairs are ordered as in a, followed by the services only present
+// in b. The missing side of a pair is nil for a service present in only one of a or b.
+func ZipByFQDN(a, b Services) []ServicePair {
+	bByFQDN := make(map[string]Instances, len(b))
+	for _, s := range b {
+		bByFQDN[s.Config().ClusterLocalFQDN()] = s
+	}
+	out := make([]ServicePair, 0, len(a))
+	paired := make(map[string]bool, len(a))
+	for _, s := range a {
+		fqdn := s.Config().ClusterLocalFQDN()
+		paired[fqdn] = true
+		out = append(out, ServicePair{A: s, B: bByFQDN[fqdn]})
+	}
+	for _, s := range b {
+		if !paired[s.Config().ClusterLocalFQDN()] {
+			out = append(out, ServicePair{B: s})
+		}
+	}
+	return out
+}
+
+// GetPrimary returns the only service in the Services. It returns an error if there are no services or more than
+// one, making the assumption of a single deployment explicit.
+func (d Services) GetPrimary() (Instances, error) {
+	switch len(d) {
+	case 0:
+		return nil, errors.New("no services")
+	case 1:
+		return d[0], nil
+	default:
+		return nil, fmt.Errorf("expected a single service, got %d: %v", len(d), d.FQDNs())
+	}
+}
+
+// AssertCount fails the test if there are not exactly expected Services, listing the Services that were found.
+func (d Services) AssertCount(t test.Failer, expected int) {
+	t.Helper()
+	if len(d) != expected {
+		t.Fatalf("expected %d services, got %d: %v", expected, len(d), d.FQDNs())
+	}
+}
+
+// AssertMinCount fails the test if there are fewer than min Services, listing the Services that were found.
+func (d Services) AssertMinCount(t test.Failer, min int) {
+	t.Helper()
+	if len(d) < min {
+		t.Fatalf("expected at least %d services, got %d: %v", min, len(d), d.FQDNs())
+	}
+}
+
+// NetworkReachable returns true if services in network to can be reached from network from. A network is always
+// reachable from itself. Across networks, traffic must go through a gateway on network to, so this asks istiod, via
+// /debug/networkz, whether it knows of such a gateway. The istiod queried is the one for the first cluster of these
+// Services on network from; if there is none, or the request fails, the networks are reported as unreachable.
+func (d Services) NetworkReachable(from network.ID, to network.ID) bool {
+	if from == to {
+		return true
+	}
+	clusters := d.AllInstances().Clusters().ByNetwork()[string(from)]
+	if len(clusters) == 0 {
+		return false
+	}
+	out, err := istiodDebugRequest(context.Background(), clusters[0], "/debug/networkz")
+	if err != nil {
+		scopes.Framework.Warnf("failed getting network gateways from cluster %s: %v", clusters[0].Name(), err)
+		return false
+	}
+	ok, err := hasNetworkGateway(out, to)
+	if err != nil {
+		scopes.Framework.Warnf("failed getting network gateways from cluster %s: %v", clusters[0].Name(), err)
+		return false
+	}
+	return ok
+}
+
+// hasNetworkGateway returns true if the output of istiod's /debug/networkz includes a gateway on the given network.
+func hasNetworkGateway(networkz string, nw network.ID) (bool, error) {
+	var gateways []model.NetworkGateway
+	if err := json.Unmarshal([]byte(networkz), &gateways); err != nil {
+		return false, fmt.Errorf("failed parsing networkz: %v", err)
+	}
+	for _, gw := range gateways {
+		if gw.Network == nw {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetCrossNetworkServices returns the Services deployed on networks other than localNetwork, which clients on
+// localNetwork can only reach via an east-west gateway. Each returned entry contains only the instances on other
+// networks, even if the original entry also spans localNetwork. The result is never nil.
+func (d Services) GetCrossNetworkServices(localNetwork network.ID) Services {
+	out := Services{}
+	for _, target := range d.deployed() {
+		var remote Instances
+		for _, instance := range target {
+			if network.ID(instance.Config().Cluster.NetworkName()) != localNetwork {
+				remote = append(remote, instance)
+			}
+		}
+		if len(remote) > 0 {
+			out = append(out, remote)
+		}
+	}
+	return out
+}
+
+// Gateways returns the Services that are deployed as gateway proxies. The result is never nil.
+func (d Services) Gateways() Services {
+	return d.Filter(Instances.IsGateway)
+}
+
+// NonGateways returns the Services that are not deployed as gateway proxies. The result is never nil.
+func (d Services) NonGateways() Services {
+	return d.Filter(func(target Instances) bool {
+		return !target.IsGateway()
+	})
+}
+
 // Services must be sorted to make sure tests have consistent ordering
 var _ sort.Interface = Services{}
 
@@ -117,9 +880,13 @@ func (d Services) Len() int {
 	return len(d)
 }
 
-// Less returns true if the element at i should appear before the element at j in a sorted Services
+// Less returns true if the element at i should appear before the element at j in a sorted Services. Elements are
+// ordered by FQDN, with ties broken by the clusters they are deployed in.
 func (d Services) Less(i, j int) bool {
-	return strings.Compare(d[i].Config().ClusterLocalFQDN(), d[j].Config().ClusterLocalFQDN()) < 0
+	if c := strings.Compare(d[i].Config().ClusterLocalFQDN(), d[j].Config().ClusterLocalFQDN()); c != 0 {
+		return c < 0
+	}
+	return clusterKey(d[i]) < clusterKey(d[j])
 }
 
 // Swap switches the positions of elements at i and j (used for sorting).
@@ -127,12 +894,46 @@ func (d Services) Swap(i, j int) {
 	d[i], d[j] = d[j], d[i]
 }
 
-// Copy this services array.
+// SortedByCluster returns a copy of the Services ordered by the clusters they are deployed in, then by FQDN.
+func (d Services) SortedByCluster() Services {
+	out := d.Copy()
+	sort.SliceStable(out, func(i, j int) bool {
+		if ci, cj := clusterKey(out[i]), clusterKey(out[j]); ci != cj {
+			return ci < cj
+		}
+		return out[i].Config().ClusterLocalFQDN() < out[j].Config().ClusterLocalFQDN()
+	})
+	return out
+}
+
+// clusterKey returns the sorted, comma-separated names of the clusters the Instances are deployed in.
+func clusterKey(target Instances) string {
+	names := target.Clusters().Names()
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// ToSlice returns the Services as a plain []Instances, for use with code that expects one. The result shares its
+// backing array with the Services; use Copy first to avoid this.
+func (d Services) ToSlice() []Instances {
+	return d
+}
+
+// Copy this services array. The contained Instances are shared with the original; use DeepCopy to avoid this.
 func (d Services) Copy() Services {
 	return append(Services{}, d...)
 }
 
-// Append returns a new Services array with the given values appended.
+// DeepCopy this services array, including each of the contained Instances arrays.
+func (d Services) DeepCopy() Services {
+	out := make(Services, 0, len(d))
+	for _, target := range d {
+		out = append(out, target.Copy())
+	}
+	return out
+}
+
+// Append returns a new Services array with the given values appended.
 func (d Services) Append(others ...Services) Services {
 	out := d.Copy()
 	for _, o := range others {
@@ -141,3 +942,1534 @@ func (d Services) Append(others ...Services) Services {
 	sort.Stable(out)
 	return out
 }
+
+// WithExternalService returns a new Services array that also contains an ExternalService for host, resolving
+// to ip on the given ports. The ExternalService is placed in the namespace shared by all of the Services, or in
+// ExternalServiceNamespace if there is no single such namespace; use NewExternalService to choose the namespace
+// explicitly. The ExternalService's ServiceEntry must be applied for it to be reachable.
+func (d Services) WithExternalService(host, ip string, ports []Port) Services {
+	var ns namespace.Instance = namespace.Static(ExternalServiceNamespace)
+	if len(d) > 0 && len(d.GetByNamespace(d[0].Config().Namespace.Name())) == len(d) {
+		ns = d[0].Config().Namespace
+	}
+	return d.Append(Services{NewExternalService(ns, host, ip, ports).Instances()})
+}
+
+// deployed returns the Services with any instances that are not deployed to a cluster, such as an
+// ExternalService, removed. Entries left with no instances are dropped.
+func (d Services) deployed() Services {
+	out := make(Services, 0, len(d))
+	for _, target := range d {
+		var instances Instances
+		for _, instance := range target {
+			if instance.Config().Cluster != nil {
+				instances = append(instances, instance)
+			}
+		}
+		if len(instances) > 0 {
+			out = append(out, instances)
+		}
+	}
+	return out
+}
+
+// AppendUnique is similar to Append, but skips any entry whose FQDN is already present in the result.
+// Entries in the receiver take precedence over those in others.
+func (d Services) AppendUnique(others ...Services) Services {
+	out := d.Copy()
+	seen := d.fqdnSet()
+	for _, o := range others {
+		for _, target := range o {
+			fqdn := target.Config().ClusterLocalFQDN()
+			if seen[fqdn] {
+				continue
+			}
+			seen[fqdn] = true
+			out = append(out, target)
+		}
+	}
+	sort.Stable(out)
+	return out
+}
+
+// MergeWith returns a new, sorted Services array combining d and others. Unlike AppendUnique, neither side takes
+// precedence: entries with the same FQDN are merged into one containing the instances of both, so that, for
+// example, merging the Services of two clusters yields multi-cluster entries. The result is never nil.
+func (d Services) MergeWith(others Services) Services {
+	var instances Instances
+	for _, target := range append(d.Copy(), others...) {
+		for _, instance := range target {
+			if !instances.Contains(instance) {
+				instances = append(instances, instance)
+			}
+		}
+	}
+	out := instances.Services()
+	if out == nil {
+		return Services{}
+	}
+	return out
+}
+
+// Subtract returns a new sorted Services containing the entries that are not present in others. Entries are
+// compared by FQDN.
+func (d Services) Subtract(others Services) Services {
+	exclude := others.fqdnSet()
+	out := d.Filter(func(target Instances) bool {
+		return !exclude[target.Config().ClusterLocalFQDN()]
+	})
+	sort.Stable(out)
+	return out
+}
+
+// Intersect returns a new sorted Services containing the entries that are also present in others. Entries are
+// compared by FQDN.
+func (d Services) Intersect(others Services) Services {
+	include := others.fqdnSet()
+	out := d.Filter(func(target Instances) bool {
+		return include[target.Config().ClusterLocalFQDN()]
+	})
+	sort.Stable(out)
+	return out
+}
+
+// Diff compares the Services to other by FQDN. Added contains the entries only in other, and removed contains
+// the entries only in the receiver. Both are sorted.
+func (d Services) Diff(other Services) (added Services, removed Services) {
+	return other.Subtract(d), d.Subtract(other)
+}
+
+func (d Services) fqdnSet() map[string]bool {
+	out := make(map[string]bool, len(d))
+	for _, target := range d {
+		out[target.Config().ClusterLocalFQDN()] = true
+	}
+	return out
+}
+
+const (
+	retryInitialDelay = 100 * time.Millisecond
+	retryMaxDelay     = 5 * time.Second
+)
+
+// WaitReady blocks until every pod of every Instance in the Services is ready, retrying with exponential backoff.
+// Returns an error naming the first service that did not become ready before ctx is done.
+func (d Services) WaitReady(ctx context.Context) error {
+	for _, target := range d.deployed() {
+		for _, instance := range target {
+			if err := waitForWorkloads(ctx, instance); err != nil {
+				return fmt.Errorf("timed out waiting for %s in cluster %s to be ready: %v",
+					target.Config().ClusterLocalFQDN(), instance.Config().Cluster.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// waitForWorkloads waits until the instance has at least one pod, and all of its pods are ready.
+func waitForWorkloads(ctx context.Context, instance Instance) error {
+	cfg := instance.Config()
+	return untilSuccess(ctx, func() error {
+		pods, err := cfg.Cluster.PodsForSelector(ctx, cfg.Namespace.Name(), "app="+cfg.Service)
+		if err != nil {
+			return err
+		}
+		if len(pods.Items) == 0 {
+			return errors.New("no pods found")
+		}
+		ready := 0
+		for _, pod := range pods.Items {
+			if podReady(pod) {
+				ready++
+			}
+		}
+		if ready != len(pods.Items) {
+			return fmt.Errorf("%d of %d pods ready", ready, len(pods.Items))
+		}
+		return nil
+	})
+}
+
+// untilSuccess retries fn with exponential backoff until it succeeds or ctx is done.
+func untilSuccess(ctx context.Context, fn func() error) error {
+	delay := retryInitialDelay
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// Synchronize blocks until istiod reports that the xDS config sent to every proxy in the Services has been
+// acknowledged. Returns an error naming the first unsynced proxy if ctx is done first.
+func (d Services) Synchronize(ctx context.Context) error {
+	proxies, err := d.proxies()
+	if err != nil {
+		return err
+	}
+	return untilSuccess(ctx, func() error {
+		syncz := map[string][]syncStatus{}
+		for _, p := range proxies {
+			primary := p.cluster.Primary().Name()
+			statuses, ok := syncz[primary]
+			if !ok {
+				if statuses, err = getSyncz(ctx, p.cluster); err != nil {
+					return err
+				}
+				syncz[primary] = statuses
+			}
+			if err := checkSynced(p, statuses); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DefaultLatencyProbes is the number of probes sent to each service by OrderByLatency.
+const DefaultLatencyProbes = 5
+
+// OrderByLatency returns a copy of the Services sorted by ascending median round-trip time of HEAD requests sent
+// from caller, using DefaultLatencyProbes probes per service.
+func (d Services) OrderByLatency(ctx context.Context, caller Instance) (Services, error) {
+	return d.OrderByLatencyWithProbes(ctx, caller, DefaultLatencyProbes)
+}
+
+// OrderByLatencyWithProbes is similar to OrderByLatency, but sends the given number of probes to each service.
+// When there are at least 3 probes, the fastest and slowest are discarded as outliers before taking the median.
+func (d Services) OrderByLatencyWithProbes(ctx context.Context, caller Instance, probes int) (Services, error) {
+	if probes <= 0 {
+		probes = DefaultLatencyProbes
+	}
+	latencies := make(map[string]time.Duration, len(d))
+	for _, target := range d {
+		fqdn := target.Config().ClusterLocalFQDN()
+		samples := make([]time.Duration, 0, probes)
+		for i := 0; i < probes; i++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			if _, err := caller.Call(CallOptions{
+				To:    target,
+				Port:  Port{Protocol: protocol.HTTP},
+				HTTP:  HTTP{Method: http.MethodHead},
+				Retry: Retry{NoRetry: true},
+			}); err != nil {
+				return nil, fmt.Errorf("failed probing latency from %s to %s: %v", caller.Config().Service, fqdn, err)
+			}
+			samples = append(samples, time.Since(start))
+		}
+		latencies[fqdn] = medianLatency(samples)
+	}
+	out := d.Copy()
+	sort.SliceStable(out, func(i, j int) bool {
+		return latencies[out[i].Config().ClusterLocalFQDN()] < latencies[out[j].Config().ClusterLocalFQDN()]
+	})
+	return out, nil
+}
+
+// medianLatency returns the median of the samples after discarding the fastest and slowest.
+func medianLatency(samples []time.Duration) time.Duration {
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	if len(samples) >= 3 {
+		samples = samples[1 : len(samples)-1]
+	}
+	return samples[len(samples)/2]
+}
+
+// GetProxyConfig returns the Envoy config dump of a sidecar for each of the Services, keyed by FQDN. The config
+// is taken from the first ready workload of each service. Services without a sidecar, or that are not deployed to a
+// cluster (see ExternalService), are omitted.
+func (d Services) GetProxyConfig(ctx context.Context) (map[string]*envoyAdmin.ConfigDump, error) {
+	return d.GetEnvoyConfig(ctx, "")
+}
+
+// GetEnvoyConfig is similar to GetProxyConfig, but if resource is set only that section of the config dump (e.g.
+// dynamic_listeners) is returned. See the resource parameter of the Envoy admin /config_dump endpoint.
+func (d Services) GetEnvoyConfig(ctx context.Context, resource string) (map[string]*envoyAdmin.ConfigDump, error) {
+	out := make(map[string]*envoyAdmin.ConfigDump, len(d))
+	for _, target := range d.deployed() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fqdn := target.Config().ClusterLocalFQDN()
+		workloads, err := target.Workloads()
+		if err != nil {
+			return nil, fmt.Errorf("failed getting workloads for %s: %v", fqdn, err)
+		}
+		sidecar := workloads[0].Sidecar()
+		if sidecar == nil {
+			continue
+		}
+		var cfg *envoyAdmin.ConfigDump
+		if resource == "" {
+			cfg, err = sidecar.Config()
+		} else {
+			cfg, err = sidecar.ResourceConfig(resource)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed getting config dump for %s: %v", fqdn, err)
+		}
+		out[fqdn] = cfg
+	}
+	return out, nil
+}
+
+// VerifyMTLS asserts that strict mTLS is enforced for HTTP traffic between from and each service in to. Callers
+// in from with a sidecar must reach the target over mTLS, while calls from callers without a sidecar (plain-text)
+// must be rejected. from must contain at least one caller of each kind. On failure, the TLS state of the request
+// is read from the access log of the target's sidecar.
+func VerifyMTLS(ctx context.Context, from, to Instances) error {
+	var mtlsCallers, plaintextCallers Instances
+	for _, caller := range from {
+		if caller.Config().IsNaked() {
+			plaintextCallers = append(plaintextCallers, caller)
+		} else {
+			mtlsCallers = append(mtlsCallers, caller)
+		}
+	}
+	if len(mtlsCallers) == 0 {
+		return fmt.Errorf("no callers with a sidecar in %v", from.Services().FQDNs())
+	}
+	if len(plaintextCallers) == 0 {
+		return fmt.Errorf("no callers without a sidecar in %v", from.Services().FQDNs())
+	}
+
+	for _, target := range to.Services() {
+		fqdn := target.Config().ClusterLocalFQDN()
+		for _, caller := range from {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			mtls := !caller.Config().IsNaked()
+			opts := CallOptions{
+				To:   target,
+				Port: Port{Protocol: protocol.HTTP},
+				HTTP: HTTP{Path: fmt.Sprintf("/verify-mtls/%d", rand.Int63())},
+			}
+			if mtls {
+				opts.Check = check.MTLSForHTTP()
+			} else {
+				opts.Check = check.Error()
+			}
+			if _, err := caller.Call(opts); err != nil {
+				return fmt.Errorf("%s to %s (expected mtls=%v, got %s): %v",
+					caller.Config().Service, fqdn, mtls, accessLogTLSState(target, opts.HTTP.Path), err)
+			}
+		}
+	}
+	return nil
+}
+
+// accessLogTLSState returns a description of the TLS state of the request with the given path, as recorded in the
+// access logs of the target's sidecars.
+func accessLogTLSState(target Instances, path string) string {
+	for _, instance := range target {
+		workloads, err := instance.Workloads()
+		if err != nil {
+			continue
+		}
+		for _, w := range workloads {
+			sidecar := w.Sidecar()
+			if sidecar == nil {
+				continue
+			}
+			logs, err := sidecar.Logs()
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(logs, "\n") {
+				if !strings.Contains(line, path) {
+					continue
+				}
+				// The default access log format ends with %REQUESTED_SERVER_NAME% %ROUTE_NAME%. A SNI is only
+				// set for mTLS traffic.
+				fields := strings.Fields(line)
+				if len(fields) < 2 || fields[len(fields)-2] == "-" {
+					return "plaintext"
+				}
+				return "mtls, sni=" + fields[len(fields)-2]
+			}
+		}
+	}
+	return "unknown tls state, no access log entry"
+}
+
+// GetEndpoints returns the endpoints istiod sends to Envoy for each of the Services, keyed by FQDN. The endpoints are
+// those of the outbound cluster for the first service port, as seen by the first workload of the service.
+func (d Services) GetEndpoints(ctx context.Context) (map[string][]*endpoint.LocalityLbEndpoints, error) {
+	proxies, err := d.proxies()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]*endpoint.LocalityLbEndpoints, len(d))
+	for _, p := range proxies {
+		if _, f := out[p.fqdn]; f {
+			continue
+		}
+		clusterName := outboundClusterName(d.MatchFQDNs(p.fqdn)[0].Config())
+		if clusterName == "" {
+			continue
+		}
+		assignments, err := getEdsz(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		out[p.fqdn] = []*endpoint.LocalityLbEndpoints{}
+		for _, cla := range assignments {
+			if cla.ClusterName == clusterName {
+				out[p.fqdn] = cla.Endpoints
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// GetActiveEndpoints is similar to GetEndpoints, but only returns the endpoints istiod reports as healthy.
+func (d Services) GetActiveEndpoints(ctx context.Context) (map[string][]*endpoint.LocalityLbEndpoints, error) {
+	return d.getEndpointsByHealth(ctx, true)
+}
+
+// GetUnhealthyEndpoints is similar to GetEndpoints, but only returns the endpoints istiod does not report as
+// healthy, for example those of pods that are not ready or are terminating.
+func (d Services) GetUnhealthyEndpoints(ctx context.Context) (map[string][]*endpoint.LocalityLbEndpoints, error) {
+	return d.getEndpointsByHealth(ctx, false)
+}
+
+func (d Services) getEndpointsByHealth(ctx context.Context, healthy bool) (map[string][]*endpoint.LocalityLbEndpoints, error) {
+	all, err := d.GetEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]*endpoint.LocalityLbEndpoints, len(all))
+	for fqdn, localities := range all {
+		filtered := []*endpoint.LocalityLbEndpoints{}
+		for _, lle := range localities {
+			var lbEndpoints []*endpoint.LbEndpoint
+			for _, lb := range lle.LbEndpoints {
+				if (lb.GetHealthStatus() == core.HealthStatus_HEALTHY) == healthy {
+					lbEndpoints = append(lbEndpoints, lb)
+				}
+			}
+			if len(lbEndpoints) == 0 {
+				continue
+			}
+			filtered = append(filtered, &endpoint.LocalityLbEndpoints{
+				Locality:            lle.Locality,
+				LbEndpoints:         lbEndpoints,
+				LoadBalancingWeight: lle.LoadBalancingWeight,
+				Priority:            lle.Priority,
+			})
+		}
+		out[fqdn] = filtered
+	}
+	return out, nil
+}
+
+// outboundClusterName returns the name of the outbound Envoy cluster for the first service port of the given
+// config, or an empty string if it has no service ports.
+func outboundClusterName(cfg Config) string {
+	for _, port := range cfg.Ports {
+		if port.ServicePort > 0 {
+			return model.BuildSubsetKey(model.TrafficDirectionOutbound, "", host.Name(cfg.ClusterLocalFQDN()), port.ServicePort)
+		}
+	}
+	return ""
+}
+
+// MultiClusterEndpoint is a single endpoint of a service, as sent by istiod to a proxy.
+type MultiClusterEndpoint struct {
+	// Service is the FQDN of the service the endpoint belongs to.
+	Service string
+	Address string
+	Port    uint32
+	// Cluster is the cluster of the workload behind the endpoint. It is empty if istiod did not include
+	// workload metadata, which is the case for endpoints reached through a network gateway.
+	Cluster  cluster.ID
+	Locality string
+	Health   string
+}
+
+// GetMultiClusterEndpoints returns the endpoints of all the Services across all clusters, as seen by a proxy
+// running in the given cluster. The endpoints are those of the outbound cluster for the first service port.
+func (d Services) GetMultiClusterEndpoints(ctx context.Context, clusterID cluster.ID) ([]MultiClusterEndpoint, error) {
+	proxies, err := d.proxies()
+	if err != nil {
+		return nil, err
+	}
+	var from *proxy
+	for i, p := range proxies {
+		if p.cluster.Name() == clusterID.String() {
+			from = &proxies[i]
+			break
+		}
+	}
+	if from == nil {
+		return nil, fmt.Errorf("no proxies for %v in cluster %s", d.FQDNs(), clusterID)
+	}
+	assignments, err := getEdsz(ctx, *from)
+	if err != nil {
+		return nil, err
+	}
+	byCluster := make(map[string]*endpoint.ClusterLoadAssignment, len(assignments))
+	for _, cla := range assignments {
+		byCluster[cla.ClusterName] = cla
+	}
+
+	var out []MultiClusterEndpoint
+	for _, target := range d {
+		cfg := target.Config()
+		cla, f := byCluster[outboundClusterName(cfg)]
+		if !f {
+			continue
+		}
+		for _, lle := range cla.Endpoints {
+			locality := ""
+			if l := lle.GetLocality(); l != nil {
+				locality = strings.TrimRight(strings.Join([]string{l.Region, l.Zone, l.SubZone}, "/"), "/")
+			}
+			for _, lb := range lle.LbEndpoints {
+				addr := lb.GetEndpoint().GetAddress().GetSocketAddress()
+				out = append(out, MultiClusterEndpoint{
+					Service:  cfg.ClusterLocalFQDN(),
+					Address:  addr.GetAddress(),
+					Port:     addr.GetPortValue(),
+					Cluster:  endpointCluster(lb),
+					Locality: locality,
+					Health:   lb.GetHealthStatus().String(),
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// endpointCluster returns the cluster encoded in the workload metadata istiod attaches to the endpoint, in the form
+// workload-name;namespace;canonical-service-name;canonical-service-revision;cluster-id.
+func endpointCluster(lb *endpoint.LbEndpoint) cluster.ID {
+	md := lb.GetMetadata().GetFilterMetadata()[util.IstioMetadataKey]
+	workload := md.GetFields()["workload"].GetStringValue()
+	parts := strings.Split(workload, ";")
+	if len(parts) < 5 {
+		return ""
+	}
+	return cluster.ID(parts[4])
+}
+
+// ScaleAll scales every instance of the Services to the given number of replicas and waits for the rollouts to
+// complete. See Instances.Scale.
+func (d Services) ScaleAll(ctx context.Context, replicas int) error {
+	return d.AllInstances().Scale(ctx, replicas)
+}
+
+// GetTelemetryConfig returns the Telemetry API config that istiod applies to each of the Services, keyed by FQDN.
+// Services that no Telemetry applies to are omitted.
+func (d Services) GetTelemetryConfig(ctx context.Context) (map[string]*telemetry.Telemetry, error) {
+	out := make(map[string]*telemetry.Telemetry, len(d))
+	byCluster := map[string]*telemetryz{}
+	for _, target := range d.deployed() {
+		cfg := target.Config()
+		primary := cfg.Cluster.Primary().Name()
+		t, f := byCluster[primary]
+		if !f {
+			var err error
+			if t, err = getTelemetryz(ctx, cfg.Cluster); err != nil {
+				return nil, err
+			}
+			byCluster[primary] = t
+		}
+		if tel := t.effective(cfg); tel != nil {
+			out[cfg.ClusterLocalFQDN()] = tel
+		}
+	}
+	return out, nil
+}
+
+// ExpectReachable calls each of the Services from the given Instance and fails the test unless every call succeeds
+// with a 200. The To field of opts is overridden for each service; any Check in opts must also pass. Calls are
+// retried according to opts.Retry.
+func (d Services) ExpectReachable(t test.Failer, from Instance, opts CallOptions) {
+	t.Helper()
+	checker := check.And(check.OK(), opts.Check)
+	for _, target := range d {
+		o := opts
+		o.To = target
+		o.Check = checker
+		if _, err := from.Call(o); err != nil {
+			t.Fatalf("expected %s to reach %s over %s: %v", from.Config().Service, target.Config().ClusterLocalFQDN(),
+				callProtocol(o), err)
+		}
+	}
+}
+
+// ExpectUnreachable calls each of the Services from the given Instance and fails the test if any call succeeds
+// with a 200. The To field of opts is overridden for each service. If opts has a Check, it is used instead to
+// verify the denial (e.g. to expect a specific status code). Calls are retried according to opts.Retry.
+func (d Services) ExpectUnreachable(t test.Failer, from Instance, opts CallOptions) {
+	t.Helper()
+	if opts.Check == nil {
+		opts.Check = check.Or(check.Error(), check.NotOK())
+	}
+	for _, target := range d {
+		o := opts
+		o.To = target
+		if _, err := from.Call(o); err != nil {
+			t.Fatalf("expected %s not to reach %s over %s: %v", from.Config().Service, target.Config().ClusterLocalFQDN(),
+				callProtocol(o), err)
+		}
+	}
+}
+
+// VerifyConnectivity calls each of the Services from the given Instance, expecting a 200 along with any Check
+// in opts. The To field of opts is overridden for each service. Rather than using opts.Retry, a failed call is
+// retried up to maxRetries times with exponential backoff; if it still fails, the last error is returned.
+func (d Services) VerifyConnectivity(ctx context.Context, from Instance, opts CallOptions, maxRetries int) error {
+	checker := check.And(check.OK(), opts.Check)
+	for _, target := range d {
+		o := opts
+		o.To = target
+		o.Check = checker
+		o.Retry.NoRetry = true
+
+		delay := retryInitialDelay
+		for attempt := 0; ; attempt++ {
+			_, err := from.Call(o)
+			if err == nil {
+				break
+			}
+			if attempt >= maxRetries {
+				return fmt.Errorf("%s could not reach %s over %s after %d attempts: %v", from.Config().Service,
+					target.Config().ClusterLocalFQDN(), callProtocol(o), attempt+1, err)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%v (last error: %v)", ctx.Err(), err)
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > retryMaxDelay {
+				delay = retryMaxDelay
+			}
+		}
+	}
+	return nil
+}
+
+// callProtocol describes the port or scheme used by the call, for error messages.
+func callProtocol(opts CallOptions) string {
+	switch {
+	case opts.Port.Name != "":
+		return "port " + opts.Port.Name
+	case opts.Port.Protocol != "":
+		return string(opts.Port.Protocol)
+	case opts.Scheme != "":
+		return string(opts.Scheme)
+	default:
+		return "default port"
+	}
+}
+
+// VerifyAccessLog polls the access logs of the sidecars of the Services until an entry matching logEntry is found.
+// An error is returned if no matching entry is found before the context is done.
+func (d Services) VerifyAccessLog(ctx context.Context, logEntry AccessLogMatcher) error {
+	return untilSuccess(ctx, func() error {
+		for _, target := range d {
+			for _, instance := range target {
+				workloads, err := instance.Workloads()
+				if err != nil {
+					return err
+				}
+				for _, w := range workloads {
+					sidecar := w.Sidecar()
+					if sidecar == nil {
+						continue
+					}
+					logs, err := sidecar.Logs()
+					if err != nil {
+						return fmt.Errorf("failed getting logs for %s: %v", w.PodName(), err)
+					}
+					for _, line := range strings.Split(logs, "\n") {
+						if logEntry.Matches(line) {
+							return nil
+						}
+					}
+				}
+			}
+		}
+		return fmt.Errorf("no access log entry matching %v in %v", logEntry, d.FQDNs())
+	})
+}
+
+// certificateExpiryThreshold is the minimum remaining validity of a workload certificate returned by
+// GetCertificates.
+const certificateExpiryThreshold = 24 * time.Hour
+
+// GetCertificates returns the workload certificate (SVID) of a sidecar for each of the Services, keyed by FQDN. The
+// certificate is taken from the SDS secrets in the config dump of the first workload of each service. Services
+// without a sidecar, or that are not deployed to a cluster, are omitted. An error is returned if a certificate does not have the SPIFFE identity of the
+// service's account, or expires within 24 hours.
+func (d Services) GetCertificates(ctx context.Context) (map[string]*x509.Certificate, error) {
+	out := make(map[string]*x509.Certificate, len(d))
+	for _, target := range d.deployed() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		cfg := target.Config()
+		fqdn := cfg.ClusterLocalFQDN()
+		workloads, err := target.Workloads()
+		if err != nil {
+			return nil, fmt.Errorf("failed getting workloads for %s: %v", fqdn, err)
+		}
+		sidecar := workloads[0].Sidecar()
+		if sidecar == nil {
+			continue
+		}
+		dump, err := sidecar.Config()
+		if err != nil {
+			return nil, fmt.Errorf("failed getting config dump for %s: %v", fqdn, err)
+		}
+		cert, err := workloadCertificate(dump)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting certificate for %s: %v", fqdn, err)
+		}
+		if err := verifyWorkloadCertificate(cert, cfg); err != nil {
+			return nil, fmt.Errorf("invalid certificate for %s: %v", fqdn, err)
+		}
+		out[fqdn] = cert
+	}
+	return out, nil
+}
+
+// workloadCertificate returns the leaf certificate of the "default" SDS secret in the config dump.
+func workloadCertificate(dump *envoyAdmin.ConfigDump) (*x509.Certificate, error) {
+	chain, err := workloadCertificateChain(dump)
+	if err != nil {
+		return nil, err
+	}
+	return chain[0], nil
+}
+
+// workloadCertificateChain returns the certificate chain of the "default" SDS secret in the config dump, starting
+// with the leaf.
+func workloadCertificateChain(dump *envoyAdmin.ConfigDump) ([]*x509.Certificate, error) {
+	for _, c := range dump.Configs {
+		secrets := &envoyAdmin.SecretsConfigDump{}
+		if !c.MessageIs(secrets) {
+			continue
+		}
+		if err := c.UnmarshalTo(secrets); err != nil {
+			return nil, err
+		}
+		for _, s := range secrets.DynamicActiveSecrets {
+			if s.Name != "default" {
+				continue
+			}
+			secret := &tls.Secret{}
+			if err := s.Secret.UnmarshalTo(secret); err != nil {
+				return nil, err
+			}
+			var chain []*x509.Certificate
+			rest := secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes()
+			for {
+				var block *pem.Block
+				block, rest = pem.Decode(rest)
+				if block == nil {
+					break
+				}
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				chain = append(chain, cert)
+			}
+			if len(chain) == 0 {
+				return nil, fmt.Errorf("no PEM certificate in secret %s", s.Name)
+			}
+			return chain, nil
+		}
+	}
+	return nil, fmt.Errorf("no active SDS secret named default")
+}
+
+// verifyWorkloadCertificate checks that the certificate has the SPIFFE identity of the service account for cfg,
+// and is not close to expiring.
+func verifyWorkloadCertificate(cert *x509.Certificate, cfg Config) error {
+	expected := fmt.Sprintf("/ns/%s/sa/%s", cfg.Namespace.Name(), cfg.ServiceAccountName())
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" || cert.URIs[0].Path != expected {
+		return fmt.Errorf("expected a single SPIFFE URI with path %s, got %v", expected, cert.URIs)
+	}
+	if remaining := time.Until(cert.NotAfter); remaining < certificateExpiryThreshold {
+		return fmt.Errorf("certificate for %s expires in %v", cert.URIs[0], remaining)
+	}
+	return nil
+}
+
+// VerifyWorkloadIdentity verifies that the sidecar of every pod of the Services presents a workload certificate
+// with the SPIFFE identity spiffe://<trustDomain>/ns/<namespace>/sa/<serviceAccount>. Pods without a sidecar are
+// skipped. The returned error lists each pod whose identity does not match, along with the URIs it presented.
+func (d Services) VerifyWorkloadIdentity(ctx context.Context, trustDomain string) error {
+	var errs error
+	for _, target := range d {
+		for _, instance := range target {
+			cfg := instance.Config()
+			expected := fmt.Sprintf("spiffe://%s/ns/%s/sa/%s", trustDomain, cfg.Namespace.Name(), cfg.ServiceAccountName())
+			workloads, err := instance.Workloads()
+			if err != nil {
+				return fmt.Errorf("failed getting workloads for %s: %v", cfg.ClusterLocalFQDN(), err)
+			}
+			for _, w := range workloads {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				sidecar := w.Sidecar()
+				if sidecar == nil {
+					continue
+				}
+				pod := w.PodName() + "." + cfg.Namespace.Name()
+				dump, err := sidecar.Config()
+				if err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("%s: failed getting config dump: %v", pod, err))
+					continue
+				}
+				cert, err := workloadCertificate(dump)
+				if err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("%s: %v", pod, err))
+					continue
+				}
+				if len(cert.URIs) != 1 || cert.URIs[0].String() != expected {
+					errs = multierror.Append(errs, fmt.Errorf("%s: expected identity %s, got %v", pod, expected, cert.URIs))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// GetSVID returns the workload certificate chain presented by the sidecar of each workload of the Services, keyed
+// by proxy ID (pod.namespace). Each chain starts with the leaf certificate, followed by any intermediate CAs. The
+// chains are taken from the SDS secrets in the sidecar's config dump. Workloads without a sidecar are omitted.
+func (d Services) GetSVID(ctx context.Context) (map[string][]*x509.Certificate, error) {
+	out := map[string][]*x509.Certificate{}
+	for _, target := range d {
+		for _, instance := range target {
+			workloads, err := instance.Workloads()
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range workloads {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				sidecar := w.Sidecar()
+				if sidecar == nil {
+					continue
+				}
+				id := w.PodName() + "." + instance.Config().Namespace.Name()
+				dump, err := sidecar.Config()
+				if err != nil {
+					return nil, fmt.Errorf("failed getting config dump for %s: %v", id, err)
+				}
+				chain, err := workloadCertificateChain(dump)
+				if err != nil {
+					return nil, fmt.Errorf("failed getting certificate chain for %s: %v", id, err)
+				}
+				out[id] = chain
+			}
+		}
+	}
+	return out, nil
+}
+
+// SimulateNetworkPartition blocks traffic from the workloads of from to the workloads of to for the given
+// duration, then restores it. The partition is created with a Kubernetes NetworkPolicy on each instance of to,
+// denying ingress from pods with the app label of any service in from, so it only applies to traffic within a
+// cluster and requires a CNI that enforces NetworkPolicy. An error is returned if the partition already exists,
+// e.g. because another call is in progress.
+func SimulateNetworkPartition(ctx context.Context, from, to Services, duration time.Duration) error {
+	apps := from.ServiceNames().Names()
+	sort.Strings(apps)
+	fromFQDNs := strings.Join(from.FQDNs(), ",")
+
+	// The NetworkPolicies that were created, so they can be removed.
+	type partition struct {
+		cfg  Config
+		name string
+	}
+	var policies []partition
+	defer func() {
+		for _, p := range policies {
+			ns := p.cfg.Namespace.Name()
+			err := p.cfg.Cluster.NetworkingV1().NetworkPolicies(ns).Delete(context.Background(), p.name, metav1.DeleteOptions{})
+			if err != nil && !kerrors.IsNotFound(err) {
+				scopes.Framework.Warnf("failed removing network partition %s/%s in cluster %s: %v", ns, p.name, p.cfg.Cluster.Name(), err)
+			}
+		}
+	}()
+	for _, target := range to.deployed() {
+		for _, instance := range target {
+			cfg := instance.Config()
+			name := partitionName(fromFQDNs, cfg)
+			policy := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": cfg.Service}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						From: []networkingv1.NetworkPolicyPeer{{
+							NamespaceSelector: &metav1.LabelSelector{},
+							PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+								Key:      "app",
+								Operator: metav1.LabelSelectorOpNotIn,
+								Values:   apps,
+							}}},
+						}},
+					}},
+				},
+			}
+			ns := cfg.Namespace.Name()
+			if _, err := cfg.Cluster.NetworkingV1().NetworkPolicies(ns).Create(ctx, policy, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("failed creating network partition for %s in cluster %s: %v",
+					cfg.ClusterLocalFQDN(), cfg.Cluster.Name(), err)
+			}
+			policies = append(policies, partition{cfg: cfg, name: name})
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// partitionName returns the name of the NetworkPolicy that partitions the instance with the given config from the
+// services with the given FQDNs. It includes the target service, and a hash of the FQDNs and the target cluster, so
+// that each target in a namespace gets its own policy.
+func partitionName(fromFQDNs string, cfg Config) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(fromFQDNs + "/" + cfg.Cluster.Name()))
+	return fmt.Sprintf("echo-partition-%s-%x", cfg.Service, h.Sum32())
+}
+
+// HealthStatus summarizes the readiness of the pods of a service across all clusters.
+type HealthStatus struct {
+	Ready    int
+	NotReady int
+	Total    int
+	// SidecarNotReady is the number of NotReady pods whose Istio init container failed or whose sidecar is
+	// not ready.
+	SidecarNotReady int
+	// AppNotReady is the number of NotReady pods for which the sidecar is healthy (or absent).
+	AppNotReady int
+}
+
+// GetHealthStatus returns the readiness of the pods of each of the Services, aggregated across all the clusters the
+// service is deployed to, keyed by FQDN.
+func (d Services) GetHealthStatus(ctx context.Context) (map[string]HealthStatus, error) {
+	out := make(map[string]HealthStatus, len(d))
+	for _, target := range d.deployed() {
+		fqdn := target.Config().ClusterLocalFQDN()
+		status := HealthStatus{}
+		for _, instance := range target {
+			cfg := instance.Config()
+			pods, err := cfg.Cluster.PodsForSelector(ctx, cfg.Namespace.Name(), "app="+cfg.Service)
+			if err != nil {
+				return nil, fmt.Errorf("failed listing pods for %s in cluster %s: %v", fqdn, cfg.Cluster.Name(), err)
+			}
+			for _, pod := range pods.Items {
+				status.Total++
+				switch {
+				case podReady(pod):
+					status.Ready++
+				case sidecarFailed(pod):
+					status.NotReady++
+					status.SidecarNotReady++
+				default:
+					status.NotReady++
+					status.AppNotReady++
+				}
+			}
+		}
+		out[fqdn] = status
+	}
+	return out, nil
+}
+
+// GetNonEmpty returns the Services that have at least one ready endpoint in any of the clusters they are deployed
+// to, according to their Kubernetes Endpoints. A warning is logged for each service that is left out, as this
+// usually means the test environment is misconfigured. The result is never nil.
+func (d Services) GetNonEmpty(ctx context.Context) (Services, error) {
+	out := Services{}
+	for _, target := range d.deployed() {
+		ready := false
+		for _, instance := range target {
+			cfg := instance.Config()
+			ep, err := cfg.Cluster.CoreV1().Endpoints(cfg.Namespace.Name()).Get(ctx, cfg.Service, metav1.GetOptions{})
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed getting endpoints for %s in cluster %s: %v",
+					cfg.ClusterLocalFQDN(), cfg.Cluster.Name(), err)
+			}
+			if hasReadyAddress(ep) {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			scopes.Framework.Warnf("service %s has no ready endpoints; skipping it", target.Config().ClusterLocalFQDN())
+			continue
+		}
+		out = append(out, target)
+	}
+	return out, nil
+}
+
+func podReady(pod kubeCore.Pod) bool {
+	if pod.Status.Phase != kubeCore.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == kubeCore.PodReady {
+			return c.Status == kubeCore.ConditionTrue
+		}
+	}
+	return false
+}
+
+// sidecarFailed returns true if the Istio init container of the pod failed, or its sidecar is not ready.
+func sidecarFailed(pod kubeCore.Pod) bool {
+	for _, c := range pod.Status.InitContainerStatuses {
+		if c.Name != "istio-init" && c.Name != "istio-validation" {
+			continue
+		}
+		if t := c.State.Terminated; t != nil && t.ExitCode != 0 {
+			return true
+		}
+		if t := c.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 {
+			return true
+		}
+	}
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.Name == "istio-proxy" && !c.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyApplied waits until the given config is known to istiod and has been pushed to the sidecar of every
+// workload of the Services, as seen in the sidecar's config dump. An error naming the proxies still missing the
+// config is returned if this does not happen before the context is done.
+func (d Services) PolicyApplied(ctx context.Context, gvk schema.GroupVersionKind, name, namespace string) error {
+	refs := configReferences(gvk, name, namespace)
+	return untilSuccess(ctx, func() error {
+		var missing []string
+		checked := map[string]bool{}
+		for _, target := range d.deployed() {
+			for _, instance := range target {
+				cfg := instance.Config()
+				if primary := cfg.Cluster.Primary().Name(); !checked[primary] {
+					found, err := hasConfig(ctx, cfg.Cluster, gvk, name, namespace)
+					if err != nil {
+						return err
+					}
+					if !found {
+						return fmt.Errorf("istiod in cluster %s does not have %s %s/%s", primary, gvk.Kind, namespace, name)
+					}
+					checked[primary] = true
+				}
+				workloads, err := instance.Workloads()
+				if err != nil {
+					return err
+				}
+				for _, w := range workloads {
+					sidecar := w.Sidecar()
+					if sidecar == nil {
+						continue
+					}
+					dump, err := sidecar.Config()
+					if err != nil {
+						return fmt.Errorf("failed getting config dump for %s: %v", w.PodName(), err)
+					}
+					js, err := protomarshal.ToJSON(dump)
+					if err != nil {
+						return err
+					}
+					if !containsAny(js, refs) {
+						missing = append(missing, fmt.Sprintf("%s.%s (%s)", w.PodName(), cfg.Namespace.Name(), cfg.ClusterLocalFQDN()))
+					}
+				}
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%s %s/%s not applied to proxies: %v", gvk.Kind, namespace, name, missing)
+		}
+		return nil
+	})
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWasmExtensions returns the Wasm HTTP filters configured in the sidecar of each workload of the Services, keyed
+// by proxy ID (pod.namespace). The extensions are read from the listeners in the sidecar's config dump.
+func (d Services) GetWasmExtensions(ctx context.Context) (map[string][]WasmExtensionStatus, error) {
+	out := map[string][]WasmExtensionStatus{}
+	for _, target := range d {
+		for _, instance := range target {
+			workloads, err := instance.Workloads()
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range workloads {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				sidecar := w.Sidecar()
+				if sidecar == nil {
+					continue
+				}
+				id := w.PodName() + "." + instance.Config().Namespace.Name()
+				dump, err := sidecar.Config()
+				if err != nil {
+					return nil, fmt.Errorf("failed getting config dump for %s: %v", id, err)
+				}
+				extensions, err := wasmExtensions(dump)
+				if err != nil {
+					return nil, fmt.Errorf("failed parsing config dump for %s: %v", id, err)
+				}
+				out[id] = extensions
+			}
+		}
+	}
+	return out, nil
+}
+
+// rateLimitWindow is the window over which VerifyRateLimit sends its requests.
+const rateLimitWindow = time.Minute
+
+// VerifyRateLimit sends rpm HTTP requests from the given Instance to each of the Services, evenly paced over a
+// minute, and checks that the fraction of requests rejected with a 429 is within tolerance of 1 - limit/rpm. limit
+// is the number of requests the local rate limit applied to the service admits in that minute, starting with a full
+// token bucket: max_tokens, plus tokens_per_fill for each fill_interval. It is read from the sidecars of the
+// service, and from the routes to the service in the sidecar of from; if more than one token bucket applies, the
+// strictest is used. Services are checked one after the other, so this takes a minute per service.
+func (d Services) VerifyRateLimit(ctx context.Context, from Instance, rpm int, tolerance float64) error {
+	if rpm <= 0 {
+		return fmt.Errorf("rpm must be positive, got %d", rpm)
+	}
+	for _, target := range d {
+		fqdn := target.Config().ClusterLocalFQDN()
+		limit, err := rateLimitFor(from, target, rateLimitWindow)
+		if err != nil {
+			return fmt.Errorf("failed getting the rate limit of %s: %v", fqdn, err)
+		}
+		if limit > rpm {
+			limit = rpm
+		}
+		expected := 1 - float64(limit)/float64(rpm)
+
+		limited := 0
+		ticker := time.NewTicker(rateLimitWindow / time.Duration(rpm))
+		for i := 0; i < rpm; i++ {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+					ticker.Stop()
+					return ctx.Err()
+				case <-ticker.C:
+				}
+			}
+			responses, err := from.Call(CallOptions{
+				To:    target,
+				Port:  Port{Protocol: protocol.HTTP},
+				Count: 1,
+				Retry: Retry{NoRetry: true},
+			})
+			if err != nil {
+				ticker.Stop()
+				return fmt.Errorf("failed calling %s from %s: %v", fqdn, from.Config().Service, err)
+			}
+			if len(responses) > 0 && responses[0].Code == strconv.Itoa(http.StatusTooManyRequests) {
+				limited++
+			}
+		}
+		ticker.Stop()
+		actual := float64(limited) / float64(rpm)
+		if math.Abs(actual-expected) > tolerance {
+			return fmt.Errorf("%s from %s: %d of %d requests were rate limited (%.2f), expected %.2f±%.2f",
+				fqdn, from.Config().Service, limited, rpm, actual, expected, tolerance)
+		}
+	}
+	return nil
+}
+
+// rateLimitFor returns the number of requests from from to target admitted within window by the strictest local
+// rate limit in the sidecars of target, or in the routes to target in the sidecar of from.
+func rateLimitFor(from Instance, target Instances, window time.Duration) (int, error) {
+	type sidecarTraffic struct {
+		instance  Instance
+		direction core.TrafficDirection
+	}
+	host := target.Config().ClusterLocalFQDN()
+	sidecars := []sidecarTraffic{{instance: from, direction: core.TrafficDirection_OUTBOUND}}
+	for _, instance := range target {
+		sidecars = append(sidecars, sidecarTraffic{instance: instance, direction: core.TrafficDirection_INBOUND})
+	}
+	limit := -1
+	for _, s := range sidecars {
+		workloads, err := s.instance.Workloads()
+		if err != nil {
+			return 0, err
+		}
+		for _, w := range workloads {
+			sidecar := w.Sidecar()
+			if sidecar == nil {
+				continue
+			}
+			dump, err := sidecar.Config()
+			if err != nil {
+				return 0, fmt.Errorf("failed getting config dump for %s: %v", w.PodName(), err)
+			}
+			buckets, err := localRateLimitBuckets(dump, s.direction, host)
+			if err != nil {
+				return 0, fmt.Errorf("failed parsing config dump for %s: %v", w.PodName(), err)
+			}
+			for _, b := range buckets {
+				if admitted := admittedRequests(b, window); limit < 0 || admitted < limit {
+					limit = admitted
+				}
+			}
+		}
+	}
+	if limit < 0 {
+		return 0, errors.New("no local rate limit found")
+	}
+	return limit, nil
+}
+
+// VerifyBurstRateLimit sends count HTTP requests from the given Instance to each of the Services back to back, and
+// checks that the fraction of requests rejected with a 429 is within tolerance of 1 - limit/count, where limit is the
+// number of requests the rate limit policy applied to the Services admits in a burst (e.g. the max_tokens of a local
+// rate limit token bucket). This checks a burst limit, not a sustained requests-per-minute rate: the requests are
+// not paced, so tokens refilled while they are in flight admit a few more requests than limit. See VerifyRateLimit
+// for a paced check of a per-minute rate.
+func (d Services) VerifyBurstRateLimit(ctx context.Context, from Instance, limit, count int, tolerance float64) error {
+	if count <= 0 {
+		return fmt.Errorf("count must be positive, got %d", count)
+	}
+	expected := 1 - float64(limit)/float64(count)
+	if expected < 0 {
+		expected = 0
+	}
+	for _, target := range d {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fqdn := target.Config().ClusterLocalFQDN()
+		responses, err := from.Call(CallOptions{
+			To:    target,
+			Port:  Port{Protocol: protocol.HTTP},
+			Count: count,
+			Retry: Retry{NoRetry: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed calling %s from %s: %v", fqdn, from.Config().Service, err)
+		}
+		if len(responses) == 0 {
+			return fmt.Errorf("no responses calling %s from %s", fqdn, from.Config().Service)
+		}
+		limited := 0
+		for _, r := range responses {
+			if r.Code == strconv.Itoa(http.StatusTooManyRequests) {
+				limited++
+			}
+		}
+		actual := float64(limited) / float64(len(responses))
+		if math.Abs(actual-expected) > tolerance {
+			return fmt.Errorf("%s from %s: %d of %d requests were rate limited (%.2f), expected %.2f±%.2f",
+				fqdn, from.Config().Service, limited, len(responses), actual, expected, tolerance)
+		}
+	}
+	return nil
+}
+
+// VerifyJWTAuth verifies that JWT authentication is enforced for each of the services, by calling them from the
+// given instance. Requests carrying validToken must succeed, with both the canonical "Bearer" and the lowercase
+// "bearer" authorization scheme, while requests carrying invalidToken must be rejected with a 401.
+// When an AuthorizationPolicy matching on request.auth.claims is applied alongside the RequestAuthentication,
+// the successful requests also confirm that the token claims are available for RBAC evaluation.
+func (d Services) VerifyJWTAuth(ctx context.Context, from Instance, validToken, invalidToken string) error {
+	type jwtCase struct {
+		name    string
+		authz   string
+		checker check.Checker
+	}
+	cases := []jwtCase{
+		{name: "valid token", authz: "Bearer " + validToken, checker: check.OK()},
+		{name: "valid token with lowercase scheme", authz: "bearer " + validToken, checker: check.OK()},
+		{name: "invalid token", authz: "Bearer " + invalidToken, checker: check.Status(http.StatusUnauthorized)},
+	}
+	for _, target := range d {
+		fqdn := target.Config().ClusterLocalFQDN()
+		for _, c := range cases {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			_, err := from.Call(CallOptions{
+				To:   target,
+				Port: Port{Protocol: protocol.HTTP},
+				HTTP: HTTP{
+					Headers: headers.New().With(headers.Authorization, c.authz).Build(),
+				},
+				Check: c.checker,
+			})
+			if err != nil {
+				return fmt.Errorf("%s from %s with %s: %v", fqdn, from.Config().Service, c.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetPeerAuthentication returns the PeerAuthentication policy that istiod selects for each of the Services, keyed by
+// FQDN: a workload-level policy matching the service's labels takes precedence over a namespace-level policy, which
+// takes precedence over the mesh-wide policy in the root namespace. Services no PeerAuthentication applies to are
+// omitted. Note that istiod merges port-level settings from each of these levels; only the most specific policy is
+// returned here.
+func (d Services) GetPeerAuthentication(ctx context.Context) (map[string]*securityv1beta1.PeerAuthentication, error) {
+	out := make(map[string]*securityv1beta1.PeerAuthentication, len(d))
+	err := d.selectConfig(ctx, gvk.PeerAuthentication.Kubernetes(), func() proto.Message {
+		return &securityv1beta1.PeerAuthentication{}
+	}, func(m proto.Message) map[string]string {
+		return m.(*securityv1beta1.PeerAuthentication).GetSelector().GetMatchLabels()
+	}, func(cfg Config, m proto.Message) {
+		out[cfg.ClusterLocalFQDN()] = m.(*securityv1beta1.PeerAuthentication)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// selectConfig calls set with the config of the given kind that istiod selects for each of the Services, if any.
+// See selectedConfig.
+func (d Services) selectConfig(ctx context.Context, kind schema.GroupVersionKind, newSpec func() proto.Message,
+	selector func(proto.Message) map[string]string, set func(Config, proto.Message)) error {
+	type istiodState struct {
+		configs       []configzEntry
+		rootNamespace string
+	}
+	byCluster := map[string]*istiodState{}
+	for _, target := range d.deployed() {
+		cfg := target.Config()
+		primary := cfg.Cluster.Primary().Name()
+		state, f := byCluster[primary]
+		if !f {
+			configs, err := getConfigz(ctx, cfg.Cluster)
+			if err != nil {
+				return err
+			}
+			rootNamespace, err := getRootNamespace(ctx, cfg.Cluster)
+			if err != nil {
+				return err
+			}
+			state = &istiodState{configs: configs, rootNamespace: rootNamespace}
+			byCluster[primary] = state
+		}
+		spec, err := selectedConfig(state.configs, kind, state.rootNamespace, cfg, newSpec, selector)
+		if err != nil {
+			return err
+		}
+		if spec != nil {
+			set(cfg, spec)
+		}
+	}
+	return nil
+}
+
+// GetSidecarConfig returns the Sidecar resource that istiod has selected for each of the Services, keyed by FQDN, as
+// computed for the first workload of each service. If the Sidecar does not set an outbound traffic policy, the one
+// istiod applies from the mesh config is filled in, so that the returned spec reflects the effective egress
+// restrictions. Services that no Sidecar applies to are omitted.
+func (d Services) GetSidecarConfig(ctx context.Context) (map[string]*networkingv1alpha3.Sidecar, error) {
+	proxies, err := d.proxies()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*networkingv1alpha3.Sidecar, len(d))
+	seen := map[string]bool{}
+	for _, p := range proxies {
+		if seen[p.fqdn] {
+			continue
+		}
+		seen[p.fqdn] = true
+		scope, err := getSidecarz(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if len(scope.Sidecar) == 0 || string(scope.Sidecar) == "null" {
+			continue
+		}
+		sidecar := &networkingv1alpha3.Sidecar{
+			ObjectMeta: metav1.ObjectMeta{Name: scope.Name, Namespace: scope.Namespace},
+		}
+		if err := json.Unmarshal(scope.Sidecar, &sidecar.Spec); err != nil {
+			return nil, fmt.Errorf("failed parsing sidecar for %s: %v", p.ID(), err)
+		}
+		if sidecar.Spec.OutboundTrafficPolicy == nil {
+			sidecar.Spec.OutboundTrafficPolicy = scope.OutboundTrafficPolicy
+		}
+		out[p.fqdn] = sidecar
+	}
+	return out, nil
+}
+
+// VerifyOutboundPolicy verifies that the REGISTRY_ONLY outbound traffic policy is enforced for the given Instance:
+// an HTTP call to unregisteredHost, which must not be in the service registry, is expected to be rejected by the
+// sidecar with a 502 or 503 or to fail outright, while each of the Services must remain reachable.
+func (d Services) VerifyOutboundPolicy(ctx context.Context, from Instance, unregisteredHost string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := from.Call(CallOptions{
+		Address: unregisteredHost,
+		Port:    Port{ServicePort: 80, Protocol: protocol.HTTP},
+		Check: check.Or(
+			check.Error(),
+			check.Status(http.StatusBadGateway),
+			check.Status(http.StatusServiceUnavailable)),
+	})
+	if err != nil {
+		return fmt.Errorf("expected %s to be blocked from unregistered host %s: %v", from.Config().Service, unregisteredHost, err)
+	}
+	for _, target := range d {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := from.Call(CallOptions{
+			To:    target,
+			Port:  Port{Protocol: protocol.HTTP},
+			Check: check.OK(),
+		})
+		if err != nil {
+			return fmt.Errorf("expected %s to reach registered service %s: %v", from.Config().Service,
+				target.Config().ClusterLocalFQDN(), err)
+		}
+	}
+	return nil
+}
+
+// GetIPAddresses returns the IP addresses of the pods of each of the Services across all clusters, keyed by FQDN.
+// Both the IPv4 and IPv6 addresses of pods in dual-stack clusters are included. Pods that have not been assigned an
+// IP yet are skipped.
+func (d Services) GetIPAddresses(ctx context.Context) (map[string][]string, error) {
+	out := make(map[string][]string, len(d))
+	for _, target := range d.deployed() {
+		fqdn := target.Config().ClusterLocalFQDN()
+		var ips []string
+		for _, instance := range target {
+			cfg := instance.Config()
+			pods, err := cfg.Cluster.PodsForSelector(ctx, cfg.Namespace.Name(), "app="+cfg.Service)
+			if err != nil {
+				return nil, fmt.Errorf("failed listing pods for %s in cluster %s: %v", fqdn, cfg.Cluster.Name(), err)
+			}
+			for _, pod := range pods.Items {
+				if len(pod.Status.PodIPs) == 0 && pod.Status.PodIP != "" {
+					ips = append(ips, pod.Status.PodIP)
+					continue
+				}
+				for _, ip := range pod.Status.PodIPs {
+					ips = append(ips, ip.IP)
+				}
+			}
+		}
+		sort.Strings(ips)
+		out[fqdn] = ips
+	}
+	return out, nil
+}
+
+// IsSidecarInjected returns, for each of the Services keyed by FQDN, whether the istio-proxy sidecar was injected
+// into every pod of the service across all clusters. A service without any pods is reported as not injected, and
+// services that are not deployed to a cluster are omitted.
+func (d Services) IsSidecarInjected(ctx context.Context) (map[string]bool, error) {
+	out := make(map[string]bool, len(d))
+	for _, target := range d.deployed() {
+		fqdn := target.Config().ClusterLocalFQDN()
+		injected, total := true, 0
+		for _, instance := range target {
+			cfg := instance.Config()
+			pods, err := cfg.Cluster.PodsForSelector(ctx, cfg.Namespace.Name(), "app="+cfg.Service)
+			if err != nil {
+				return nil, fmt.Errorf("failed listing pods for %s in cluster %s: %v", fqdn, cfg.Cluster.Name(), err)
+			}
+			for _, pod := range pods.Items {
+				total++
+				if !hasSidecar(pod) {
+					injected = false
+				}
+			}
+		}
+		out[fqdn] = injected && total > 0
+	}
+	return out, nil
+}
+
+// AssertSidecarInjected fails the test if the sidecar was not injected into every pod of each of the Services that
+// is deployed to a cluster. See IsSidecarInjected.
+func (d Services) AssertSidecarInjected(t test.Failer) {
+	t.Helper()
+	injected, err := d.IsSidecarInjected(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing []string
+	for _, fqdn := range d.deployed().FQDNs() {
+		if !injected[fqdn] {
+			missing = append(missing, fqdn)
+		}
+	}
+	if len(missing) > 0 {
+		t.Fatalf("sidecar not injected into all pods of %v", missing)
+	}
+}
+
+// hasSidecar returns true if the pod has an istio-proxy container, either as a regular container or as a native
+// sidecar (init) container.
+func hasSidecar(pod kubeCore.Pod) bool {
+	for _, containers := range [][]kubeCore.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			if c.Name == "istio-proxy" {
+				return true
+			}
+		}
+	}
+	return false
+}
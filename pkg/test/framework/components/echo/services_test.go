@@ -0,0 +1,1100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kubeCore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"istio.io/api/annotation"
+	networking "istio.io/api/networking/v1alpha3"
+	networkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/cluster"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/test"
+	echoClient "istio.io/istio/pkg/test/echo"
+	fwcluster "istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+var (
+	echo1NS = namespace.Static("echo1")
+	echo2NS = namespace.Static("echo2")
+
+	// 2 clusters on 2 networks
+	cls1 = &fwcluster.FakeCluster{Topology: fwcluster.Topology{ClusterName: "cls1", Network: "n1", Index: 0, ClusterKind: fwcluster.Fake}}
+	cls2 = &fwcluster.FakeCluster{Topology: fwcluster.Topology{ClusterName: "cls2", Network: "n2", Index: 1, ClusterKind: fwcluster.Fake}}
+
+	a1    = &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "a"}
+	a2    = &fakeInstance{Cluster: cls2, Namespace: echo1NS, Service: "a"}
+	b1    = &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "b", Subsets: []echo.SubsetConfig{{Version: "v1"}, {Version: "v2"}}}
+	c2    = &fakeInstance{Cluster: cls2, Namespace: echo1NS, Service: "c"}
+	a1Ns2 = &fakeInstance{Cluster: cls1, Namespace: echo2NS, Service: "a"}
+
+	all = echo.Instances{a1, a2, b1, c2, a1Ns2}
+)
+
+func TestGetAllByService(t *testing.T) {
+	services := all.Services()
+	if diff := cmp.Diff(services.GetAllByService("a").FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"a.echo2.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := services.GetAllByService("missing"); len(got) != 0 {
+		t.Fatalf("expected no matches, got %v", got.FQDNs())
+	}
+	if got := services.GetByService("a"); got.Config().ClusterLocalFQDN() != "a.echo1.svc.cluster.local" {
+		t.Fatalf("expected first match, got %s", got.Config().ClusterLocalFQDN())
+	}
+	if got := services.GetByService("B"); got == nil || got.Config().ClusterLocalFQDN() != "b.echo1.svc.cluster.local" {
+		t.Fatalf("expected case-insensitive match for B, got %v", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	services := all.Services()
+	got := services.Filter(func(target echo.Instances) bool {
+		return target.Config().Namespace.Name() == echo1NS.Name()
+	})
+	if diff := cmp.Diff(got.FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"b.echo1.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	none := services.Filter(func(echo.Instances) bool { return false })
+	if none == nil || len(none) != 0 {
+		t.Fatalf("expected empty non-nil Services, got %#v", none)
+	}
+	if len(services) != 4 {
+		t.Fatalf("receiver was modified: %v", services.FQDNs())
+	}
+}
+
+func TestMatchFQDNsGlob(t *testing.T) {
+	services := all.Services()
+	cases := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			name:     "exact",
+			patterns: []string{"b.echo1.svc.cluster.local"},
+			want:     []string{"b.echo1.svc.cluster.local"},
+		},
+		{
+			name:     "suffix",
+			patterns: []string{"*.echo2.svc.cluster.local"},
+			want:     []string{"a.echo2.svc.cluster.local"},
+		},
+		{
+			name:     "prefix",
+			patterns: []string{"a.*"},
+			want:     []string{"a.echo1.svc.cluster.local", "a.echo2.svc.cluster.local"},
+		},
+		{
+			name:     "no match",
+			patterns: []string{"*.example.com"},
+			want:     nil,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := services.MatchFQDNsGlob(tt.patterns...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got.FQDNs(), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+	if _, err := services.MatchFQDNsGlob("a.["); err == nil {
+		t.Fatal("expected error for malformed pattern")
+	}
+}
+
+func TestSubtractIntersect(t *testing.T) {
+	services := all.Services()
+	others := echo.Instances{b1, a1Ns2}.Services()
+	if diff := cmp.Diff(services.Subtract(others).FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(services.Intersect(others).FQDNs(), []string{
+		"a.echo2.svc.cluster.local",
+		"b.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestAppendUnique(t *testing.T) {
+	a := echo.Instances{b1, a1}.Services()
+	b := echo.Instances{c2, a1Ns2}.Services()
+	got := a.AppendUnique(b, a)
+	if diff := cmp.Diff(got.FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"a.echo2.svc.cluster.local",
+		"b.echo1.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestGroupByCluster(t *testing.T) {
+	got := map[cluster.ID][]string{}
+	for c, services := range all.Services().GroupByCluster() {
+		for _, target := range services {
+			for _, instance := range target {
+				got[c] = append(got[c], instance.Config().Cluster.Name()+"/"+instance.Config().ClusterLocalFQDN())
+			}
+		}
+	}
+	if diff := cmp.Diff(got, map[cluster.ID][]string{
+		"cls1": {
+			"cls1/a.echo1.svc.cluster.local",
+			"cls1/a.echo2.svc.cluster.local",
+			"cls1/b.echo1.svc.cluster.local",
+		},
+		"cls2": {
+			"cls2/a.echo1.svc.cluster.local",
+			"cls2/c.echo1.svc.cluster.local",
+		},
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestGetByCluster(t *testing.T) {
+	names := func(services echo.Services) []string {
+		var out []string
+		for _, target := range services {
+			for _, instance := range target {
+				out = append(out, instance.Config().Cluster.Name()+"/"+instance.Config().ClusterLocalFQDN())
+			}
+		}
+		return out
+	}
+	services := all.Services()
+	if diff := cmp.Diff(names(services.GetByCluster("cls2")), []string{
+		"cls2/a.echo1.svc.cluster.local",
+		"cls2/c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(names(services.GetByCluster("cls1", "cls2")), names(services)); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := services.GetByCluster("cls3"); got == nil || len(got) != 0 {
+		t.Fatalf("expected empty, non-nil services, got %v", got)
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	services := all.Services()
+	cp := services.DeepCopy()
+	cp[0][0] = b1
+	if services[0][0] == echo.Instance(b1) {
+		t.Fatal("DeepCopy shares Instances with the original")
+	}
+}
+
+func TestGetByLabel(t *testing.T) {
+	services := all.Services()
+	if diff := cmp.Diff(services.GetByLabel("version", "v2").FQDNs(), []string{"b.echo1.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+	selector, err := labels.Parse("app in (a,c),version=v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(services.GetByLabelSelector(selector).FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"a.echo2.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := services.GetByLabel("version", "v3"); got == nil || len(got) != 0 {
+		t.Fatalf("expected empty non-nil Services, got %#v", got)
+	}
+}
+
+func TestSortByCluster(t *testing.T) {
+	services := echo.Services{{a2}, {b1}, {a1}}
+	sort.Sort(services)
+	if diff := cmp.Diff(clusterFQDNs(services), []string{
+		"cls1/a.echo1.svc.cluster.local",
+		"cls2/a.echo1.svc.cluster.local",
+		"cls1/b.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(clusterFQDNs(services.SortedByCluster()), []string{
+		"cls1/a.echo1.svc.cluster.local",
+		"cls1/b.echo1.svc.cluster.local",
+		"cls2/a.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func clusterFQDNs(services echo.Services) []string {
+	var out []string
+	for _, target := range services {
+		out = append(out, target.Config().Cluster.Name()+"/"+target.Config().ClusterLocalFQDN())
+	}
+	return out
+}
+
+func TestGetByServiceAccount(t *testing.T) {
+	a1SA := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "a", ServiceAccount: true}
+	c1SA := &fakeInstance{Cluster: cls1, Namespace: echo2NS, Service: "c", ServiceAccount: true}
+	services := echo.Instances{a1SA, b1, c1SA}.Services()
+	cases := []struct {
+		sa   string
+		want []string
+	}{
+		{"a", []string{"a.echo1.svc.cluster.local"}},
+		{"c@echo2", []string{"c.echo2.svc.cluster.local"}},
+		{"c@echo1", nil},
+		{"default", []string{"b.echo1.svc.cluster.local"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.sa, func(t *testing.T) {
+			if diff := cmp.Diff(services.GetByServiceAccount(tt.sa).FQDNs(), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestServiceNamesWithNamespacePrefix(t *testing.T) {
+	services := echo.Instances{c2, a1Ns2, b1, a1}.Services()
+	if diff := cmp.Diff(services.ServiceNamesWithNamespacePrefix().NamespacedNames(), []string{
+		"a.echo1",
+		"b.echo1",
+		"c.echo1",
+		"a.echo2",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFQDNsForCluster(t *testing.T) {
+	services := all.Services()
+	if diff := cmp.Diff(services.FQDNsForCluster("cls2"), []string{
+		"a.echo1.svc.cluster.local",
+		"a.echo2.svc.clusterset.local",
+		"b.echo1.svc.clusterset.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestGetByVirtualService(t *testing.T) {
+	services := all.Services()
+	cases := []struct {
+		name  string
+		hosts []string
+		want  []string
+	}{
+		{"short name", []string{"b"}, []string{"b.echo1.svc.cluster.local"}},
+		{"namespaced name", []string{"a.echo2"}, []string{"a.echo2.svc.cluster.local"}},
+		{"fqdn", []string{"c.echo1.svc.cluster.local"}, []string{"c.echo1.svc.cluster.local"}},
+		{"wildcard", []string{"*"}, []string{
+			"a.echo1.svc.cluster.local",
+			"b.echo1.svc.cluster.local",
+			"c.echo1.svc.cluster.local",
+		}},
+		{"wildcard suffix", []string{"*.echo2.svc.cluster.local"}, []string{"a.echo2.svc.cluster.local"}},
+		{"no match", []string{"example.com"}, nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := &networkingv1alpha3.VirtualService{
+				ObjectMeta: metav1.ObjectMeta{Namespace: echo1NS.Name()},
+				Spec:       networking.VirtualService{Hosts: tt.hosts},
+			}
+			if diff := cmp.Diff(services.GetByVirtualService(vs).FQDNs(), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestGetByDestinationRule(t *testing.T) {
+	services := all.Services()
+	cases := []struct {
+		name      string
+		namespace string
+		host      string
+		want      []string
+	}{
+		{"short name", echo1NS.Name(), "b", []string{"b.echo1.svc.cluster.local"}},
+		{"short name in other namespace", echo2NS.Name(), "c", nil},
+		{"namespaced name", echo1NS.Name(), "a.echo2", []string{"a.echo2.svc.cluster.local"}},
+		{"fqdn", echo2NS.Name(), "c.echo1.svc.cluster.local", []string{"c.echo1.svc.cluster.local"}},
+		{"wildcard suffix", echo2NS.Name(), "*.echo1.svc.cluster.local", []string{
+			"a.echo1.svc.cluster.local",
+			"b.echo1.svc.cluster.local",
+			"c.echo1.svc.cluster.local",
+		}},
+		{"no match", echo1NS.Name(), "example.com", nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dr := &networkingv1alpha3.DestinationRule{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace},
+				Spec:       networking.DestinationRule{Host: tt.host},
+			}
+			if diff := cmp.Diff(services.GetByDestinationRule(dr).FQDNs(), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestFilterBySubset(t *testing.T) {
+	services := all.Services()
+	dr := &networkingv1alpha3.DestinationRule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: echo1NS.Name()},
+		Spec: networking.DestinationRule{
+			Host: "*.echo1.svc.cluster.local",
+			Subsets: []*networking.Subset{
+				{Name: "v1", Labels: map[string]string{"version": "v1"}},
+				{Name: "v2", Labels: map[string]string{"version": "v2"}},
+				{Name: "v3", Labels: map[string]string{"version": "v3"}},
+			},
+		},
+	}
+	cases := []struct {
+		subset string
+		want   []string
+	}{
+		{"v1", []string{
+			"a.echo1.svc.cluster.local",
+			"b.echo1.svc.cluster.local",
+			"c.echo1.svc.cluster.local",
+		}},
+		{"v2", []string{"b.echo1.svc.cluster.local"}},
+		{"v3", nil},
+		{"missing", nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.subset, func(t *testing.T) {
+			got := services.FilterBySubset(dr, tt.subset)
+			if got == nil {
+				t.Fatal("expected non-nil Services")
+			}
+			if diff := cmp.Diff(got.FQDNs(), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestZip(t *testing.T) {
+	a := echo.Services{{a1}, {b1}, {c2}}
+	b := echo.Services{{c2}, {a1Ns2}}
+	fqdns := func(pairs []echo.ServicePair) [][2]string {
+		var out [][2]string
+		for _, p := range pairs {
+			var pair [2]string
+			if p.A != nil {
+				pair[0] = p.A.Config().ClusterLocalFQDN()
+			}
+			if p.B != nil {
+				pair[1] = p.B.Config().ClusterLocalFQDN()
+			}
+			out = append(out, pair)
+		}
+		return out
+	}
+	t.Run("Zip", func(t *testing.T) {
+		if diff := cmp.Diff(fqdns(echo.Zip(a, b)), [][2]string{
+			{"a.echo1.svc.cluster.local", "c.echo1.svc.cluster.local"},
+			{"b.echo1.svc.cluster.local", "a.echo2.svc.cluster.local"},
+		}); diff != "" {
+			t.Fatal(diff)
+		}
+		if got := echo.Zip(a, nil); len(got) != 0 {
+			t.Fatalf("expected no pairs, got %d", len(got))
+		}
+	})
+	t.Run("ZipByFQDN", func(t *testing.T) {
+		if diff := cmp.Diff(fqdns(echo.ZipByFQDN(a, b)), [][2]string{
+			{"a.echo1.svc.cluster.local", ""},
+			{"b.echo1.svc.cluster.local", ""},
+			{"c.echo1.svc.cluster.local", "c.echo1.svc.cluster.local"},
+			{"", "a.echo2.svc.cluster.local"},
+		}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestGetPrimary(t *testing.T) {
+	if _, err := (echo.Services{}).GetPrimary(); err == nil {
+		t.Fatal("expected error for no services")
+	}
+	if _, err := all.Services().GetPrimary(); err == nil {
+		t.Fatal("expected error for multiple services")
+	}
+	got, err := echo.Instances{a1, a2}.Services().GetPrimary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got.Config().ClusterLocalFQDN(), "a.echo1.svc.cluster.local"); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFilterAmbient(t *testing.T) {
+	ambient := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "ambient", AmbientMode: true}
+	ambient2 := &fakeInstance{Cluster: cls2, Namespace: echo1NS, Service: "ambient", AmbientMode: true}
+	// Only one of the instances of mixed is enrolled, so the service as a whole is not.
+	mixed := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "mixed", AmbientMode: true}
+	mixed2 := &fakeInstance{Cluster: cls2, Namespace: echo1NS, Service: "mixed"}
+	services := echo.Instances{a1, ambient, ambient2, mixed, mixed2}.Services()
+	if diff := cmp.Diff(services.FilterAmbient().FQDNs(), []string{"ambient.echo1.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(services.FilterSidecar().FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"mixed.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+type fakeScaler struct {
+	fakeInstance
+	scaled *int32
+}
+
+func (f fakeScaler) Scale(context.Context, int) error {
+	atomic.AddInt32(f.scaled, 1)
+	return nil
+}
+
+func TestScale(t *testing.T) {
+	var scaled int32
+	s1 := fakeScaler{fakeInstance: *a1, scaled: &scaled}
+	s2 := fakeScaler{fakeInstance: *a2, scaled: &scaled}
+	if err := (echo.Instances{s1, s2}).Scale(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	if scaled != 2 {
+		t.Fatalf("expected both instances to be scaled, got %d", scaled)
+	}
+
+	scaled = 0
+	if err := (echo.Instances{s1, b1, s2}).Scale(context.Background(), 2); err == nil {
+		t.Fatal("expected an error for an instance that does not support scaling")
+	}
+	if scaled != 0 {
+		t.Fatalf("expected no instances to be scaled, got %d", scaled)
+	}
+}
+
+func TestGetByProtocol(t *testing.T) {
+	httpSvc := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "http", Ports: echo.Ports{
+		{Name: "http", Protocol: protocol.HTTP, ServicePort: 80},
+	}}
+	mixedSvc := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "mixed", Ports: echo.Ports{
+		{Name: "tcp", Protocol: protocol.TCP, ServicePort: 9090},
+		{Name: "custom", Protocol: "custom", ServicePort: 9091},
+	}}
+	services := echo.Instances{httpSvc, mixedSvc}.Services()
+
+	cases := []struct {
+		protocol protocol.Instance
+		want     []string
+	}{
+		{protocol.HTTP, []string{"http.echo1.svc.cluster.local"}},
+		{protocol.TCP, []string{"mixed.echo1.svc.cluster.local"}},
+		{protocol.Unsupported, []string{"mixed.echo1.svc.cluster.local"}},
+		{protocol.HTTPS, nil},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.protocol), func(t *testing.T) {
+			if diff := cmp.Diff(services.GetByProtocol(tc.protocol).FQDNs(), tc.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestGetByAnnotationKey(t *testing.T) {
+	injected := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "injected",
+		ServiceAnnotations: echo.NewAnnotations().Set(echo.SidecarInject, "true")}
+	disabled := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "disabled",
+		ServiceAnnotations: echo.NewAnnotations().Set(echo.SidecarInject, "false")}
+	plain := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "plain"}
+	services := echo.Instances{injected, disabled, plain}.Services()
+
+	key := echo.SidecarInject.Name
+	if diff := cmp.Diff(services.GetByAnnotationKey(key).FQDNs(), []string{
+		"disabled.echo1.svc.cluster.local",
+		"injected.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(services.GetByAnnotationAbsent(key).FQDNs(), []string{"plain.echo1.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWithExternalService(t *testing.T) {
+	ports := []echo.Port{{Name: "http", Protocol: protocol.HTTP, ServicePort: 80}}
+	services := all.Services().WithExternalService("api.example.com", "10.0.0.1", ports)
+	if got, want := len(services), len(all.Services())+1; got != want {
+		t.Fatalf("expected %d services, got %d", want, got)
+	}
+
+	external := services.GetByProtocol(protocol.HTTP).Filter(func(target echo.Instances) bool {
+		return target.Config().IsExternal()
+	})
+	if len(external) != 1 {
+		t.Fatalf("expected a single external service, got %v", external.ServiceNames())
+	}
+	svc := external[0][0].(*echo.ExternalService)
+	if svc.Address() != "10.0.0.1" {
+		t.Fatalf("unexpected address %q", svc.Address())
+	}
+	se := svc.ServiceEntry()
+	if diff := cmp.Diff(se.Spec.Hosts, []string{"api.example.com"}); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(se.Spec.Ports) != 1 || se.Spec.Ports[0].Number != 80 || se.Spec.Ports[0].Protocol != "HTTP" {
+		t.Fatalf("unexpected ports %v", se.Spec.Ports)
+	}
+	if got := se.Namespace; got != echo.ExternalServiceNamespace {
+		t.Fatalf("expected services spanning namespaces to use %s, got %s", echo.ExternalServiceNamespace, got)
+	}
+
+	shared := all.Services().GetByNamespace(echo2NS.Name()).WithExternalService("api.example.com", "10.0.0.1", ports)
+	if got := shared.GetByService("api").Config().Namespace.Name(); got != echo2NS.Name() {
+		t.Fatalf("expected the shared namespace %s, got %s", echo2NS.Name(), got)
+	}
+}
+
+func TestExternalServiceInServices(t *testing.T) {
+	ports := []echo.Port{{Name: "http", Protocol: protocol.HTTP, ServicePort: 80}}
+	// Shares its FQDN with the a.echo1 entry, so sorting has to compare their clusters.
+	external := echo.NewExternalService(echo1NS, "a.example.com", "10.0.0.1", ports)
+	services := all.Services().Append(echo.Services{external.Instances()})
+	sort.Sort(services)
+
+	// The external service has no clusters, so it sorts first.
+	if diff := cmp.Diff(services.SortedByCluster().FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"a.echo2.svc.cluster.local",
+		"b.echo1.svc.cluster.local",
+		"a.echo1.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	for c, grouped := range services.GroupByCluster() {
+		if diff := cmp.Diff(grouped.FQDNs(), all.Services().GroupByCluster()[c].FQDNs()); diff != "" {
+			t.Fatalf("%s: %s", c, diff)
+		}
+	}
+	if diff := cmp.Diff(services.GetByCluster("cls1").FQDNs(), all.Services().GetByCluster("cls1").FQDNs()); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := services.FQDNsForCluster("cls1"); len(got) != len(services) {
+		t.Fatalf("expected an FQDN for every entry, got %v", got)
+	}
+	if !services.NetworkReachable("n1", "n1") {
+		t.Fatal("expected n1 to be reachable from itself")
+	}
+	if diff := cmp.Diff(services.GetCrossNetworkServices("n1").FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := len(services.AllInstances().Clusters()); got != 2 {
+		t.Fatalf("expected 2 clusters, got %d", got)
+	}
+}
+
+// noSidecarInstance is a fakeInstance with a single workload that has no sidecar.
+type noSidecarInstance struct {
+	fakeInstance
+}
+
+func (f noSidecarInstance) Instances() echo.Instances {
+	return echo.Instances{f}
+}
+
+func (f noSidecarInstance) Workloads() (echo.Workloads, error) {
+	return echo.Workloads{noSidecarWorkload{}}, nil
+}
+
+type noSidecarWorkload struct {
+	echo.Workload
+}
+
+func (noSidecarWorkload) Sidecar() echo.Sidecar {
+	return nil
+}
+
+func TestExternalServiceInProxyHelpers(t *testing.T) {
+	external := echo.NewExternalService(echo1NS, "api.example.com", "10.0.0.1", nil)
+	services := echo.Services{noSidecarInstance{*a1}.Instances(), external.Instances()}
+	ctx := context.Background()
+
+	configs, err := services.GetEnvoyConfig(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 0 {
+		t.Fatalf("expected no config dumps, got %v", configs)
+	}
+	certs, err := services.GetCertificates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 0 {
+		t.Fatalf("expected no certificates, got %v", certs)
+	}
+}
+
+func TestAssertSidecarInjectedWithExternalService(t *testing.T) {
+	c := &fwcluster.FakeCluster{
+		ExtendedClient: kube.NewFakeClient(),
+		Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+	}
+	pod := &kubeCore.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-1", Namespace: echo1NS.Name(), Labels: map[string]string{"app": "a"}},
+		Spec:       kubeCore.PodSpec{Containers: []kubeCore.Container{{Name: "app"}, {Name: "istio-proxy"}}},
+	}
+	if _, err := c.CoreV1().Pods(echo1NS.Name()).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	external := echo.NewExternalService(echo1NS, "api.example.com", "10.0.0.1", nil)
+	services := echo.Instances{&fakeInstance{Cluster: c, Namespace: echo1NS, Service: "a"}, external}.Services()
+
+	if err := test.Wrap(services.AssertSidecarInjected); err != nil {
+		t.Fatalf("expected the external service to be skipped, got %v", err)
+	}
+}
+
+func TestGetCrossNetworkServices(t *testing.T) {
+	remote := all.Services().GetCrossNetworkServices("n1")
+	if diff := cmp.Diff(remote.FQDNs(), []string{"a.echo1.svc.cluster.local", "c.echo1.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+	for _, target := range remote {
+		for _, instance := range target {
+			if got := instance.Config().Cluster.NetworkName(); got != "n2" {
+				t.Fatalf("%s: expected only instances on n2, got one on %s", target.Config().Service, got)
+			}
+		}
+	}
+	if got := all.Services().GetCrossNetworkServices("n3"); len(got) != len(all.Services()) {
+		t.Fatalf("expected all services to be cross-network from n3, got %v", got.ServiceNames())
+	}
+}
+
+func TestAssertCount(t *testing.T) {
+	services := all.Services()
+	if err := test.Wrap(func(t test.Failer) { services.AssertCount(t, len(services)) }); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if err := test.Wrap(func(t test.Failer) { services.AssertMinCount(t, 2) }); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+
+	err := test.Wrap(func(t test.Failer) { services.AssertCount(t, 2) })
+	if err == nil || !strings.Contains(err.Error(), "b.echo1.svc.cluster.local") {
+		t.Fatalf("expected failure listing the services, got %v", err)
+	}
+	if err := test.Wrap(func(t test.Failer) { services.AssertMinCount(t, 10) }); err == nil {
+		t.Fatal("expected failure")
+	}
+}
+
+func TestGetByNamespace(t *testing.T) {
+	services := all.Services()
+	if diff := cmp.Diff(services.GetByNamespace("echo2").FQDNs(), []string{"a.echo2.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(services.ForNamespace(echo1NS).FQDNs(), []string{
+		"a.echo1.svc.cluster.local",
+		"b.echo1.svc.cluster.local",
+		"c.echo1.svc.cluster.local",
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := services.GetByNamespace("echo3"); got == nil || len(got) != 0 {
+		t.Fatalf("expected empty non-nil Services, got %#v", got)
+	}
+}
+
+func TestGetNonEmpty(t *testing.T) {
+	ctx := context.Background()
+	c := &fwcluster.FakeCluster{
+		ExtendedClient: kube.NewFakeClient(),
+		Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+	}
+	ready := &fakeInstance{Cluster: c, Namespace: echo1NS, Service: "ready"}
+	notReady := &fakeInstance{Cluster: c, Namespace: echo1NS, Service: "not-ready"}
+	missing := &fakeInstance{Cluster: c, Namespace: echo1NS, Service: "missing"}
+
+	for name, addresses := range map[string][]kubeCore.EndpointAddress{
+		"ready":     {{IP: "10.0.0.1"}},
+		"not-ready": nil,
+	} {
+		ep := &kubeCore.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: echo1NS.Name()},
+			Subsets: []kubeCore.EndpointSubset{{
+				Addresses:         addresses,
+				NotReadyAddresses: []kubeCore.EndpointAddress{{IP: "10.0.0.2"}},
+			}},
+		}
+		if _, err := c.CoreV1().Endpoints(echo1NS.Name()).Create(ctx, ep, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := echo.Instances{ready, notReady, missing}.Services().GetNonEmpty(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got.FQDNs(), []string{"ready.echo1.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	c := &fwcluster.FakeCluster{
+		ExtendedClient: kube.NewFakeClient(),
+		Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+	}
+	services := echo.Instances{&fakeInstance{Cluster: c, Namespace: echo1NS, Service: "a"}}.Services()
+	pods := c.CoreV1().Pods(echo1NS.Name())
+	pod := func(name string, ready kubeCore.ConditionStatus) *kubeCore.Pod {
+		return &kubeCore.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: echo1NS.Name(), Labels: map[string]string{"app": "a"}},
+			Status: kubeCore.PodStatus{
+				Phase:      kubeCore.PodRunning,
+				Conditions: []kubeCore.PodCondition{{Type: kubeCore.PodReady, Status: ready}},
+			},
+		}
+	}
+	waitReady := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		return services.WaitReady(ctx)
+	}
+
+	if err := waitReady(); err == nil {
+		t.Fatal("expected a service without pods not to be ready")
+	}
+	for _, p := range []*kubeCore.Pod{pod("a-1", kubeCore.ConditionTrue), pod("a-2", kubeCore.ConditionFalse)} {
+		if _, err := pods.Create(context.Background(), p, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := waitReady()
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 pods ready") {
+		t.Fatalf("expected only one of two pods to be ready, got %v", err)
+	}
+	if _, err := pods.UpdateStatus(context.Background(), pod("a-2", kubeCore.ConditionTrue), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitReady(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetworkReachable(t *testing.T) {
+	// The clusters span two networks, but there is no istiod to report a gateway between them.
+	c1 := &fwcluster.FakeCluster{
+		ExtendedClient: kube.NewFakeClient(),
+		Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+	}
+	c1.Topology.PrimaryClusterName = c1.Name()
+	c1.Topology.ConfigClusterName = c1.Name()
+	c1.Topology.AllClusters = fwcluster.Map{c1.Name(): c1}
+	services := echo.Instances{
+		&fakeInstance{Cluster: c1, Namespace: echo1NS, Service: "a"},
+		&fakeInstance{Cluster: cls2, Namespace: echo1NS, Service: "a"},
+	}.Services()
+
+	if !services.NetworkReachable("n1", "n1") {
+		t.Fatal("expected n1 to be reachable from itself")
+	}
+	if services.NetworkReachable("n1", "n2") {
+		t.Fatal("expected n2 not to be reachable without a gateway")
+	}
+	if services.NetworkReachable("n3", "n1") {
+		t.Fatal("expected n1 not to be reachable from a network without clusters")
+	}
+}
+
+func TestSimulateNetworkPartition(t *testing.T) {
+	c := &fwcluster.FakeCluster{
+		ExtendedClient: kube.NewFakeClient(),
+		Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+	}
+	from := echo.Instances{&fakeInstance{Cluster: c, Namespace: echo1NS, Service: "a"}}.Services()
+	// Both targets are in the same namespace and cluster, so each needs its own NetworkPolicy.
+	to := echo.Instances{
+		&fakeInstance{Cluster: c, Namespace: echo1NS, Service: "b"},
+		&fakeInstance{Cluster: c, Namespace: echo1NS, Service: "c"},
+	}.Services()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- echo.SimulateNetworkPartition(ctx, from, to, time.Hour)
+	}()
+
+	policies := c.NetworkingV1().NetworkPolicies(echo1NS.Name())
+	retry.UntilSuccessOrFail(t, func() error {
+		list, err := policies.List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		var selected []string
+		for _, p := range list.Items {
+			selected = append(selected, p.Spec.PodSelector.MatchLabels["app"])
+		}
+		sort.Strings(selected)
+		if diff := cmp.Diff(selected, []string{"b", "c"}); diff != "" {
+			return errors.New(diff)
+		}
+		return nil
+	}, retry.Timeout(10*time.Second), retry.Delay(10*time.Millisecond))
+
+	// The partition is already in place, so a second one cannot be created.
+	if err := echo.SimulateNetworkPartition(context.Background(), from, to, time.Hour); err == nil {
+		t.Fatal("expected an error for an existing partition")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected the partition to be interrupted, got %v", err)
+	}
+	list, err := policies.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Fatalf("expected the partition to be removed, got %d policies", len(list.Items))
+	}
+}
+
+func TestMergeWith(t *testing.T) {
+	services := all.Services()
+	merged := services.ForCluster("cls1").MergeWith(services.ForCluster("cls2"))
+	if diff := cmp.Diff(merged.FQDNs(), services.FQDNs()); diff != "" {
+		t.Fatal(diff)
+	}
+	if a := merged.GetByFQDN("a.echo1.svc.cluster.local"); len(a.Instances()) != 2 {
+		t.Fatalf("expected a to span both clusters, got %d instances", len(a.Instances()))
+	}
+
+	// Merging is symmetric and ignores duplicates.
+	again := services.MergeWith(services.ForCluster("cls1"))
+	if diff := cmp.Diff(again.FQDNs(), services.FQDNs()); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := len(again.AllInstances()); got != len(all) {
+		t.Fatalf("expected %d instances, got %d", len(all), got)
+	}
+	if got := (echo.Services{}).MergeWith(nil); got == nil || len(got) != 0 {
+		t.Fatalf("expected empty non-nil Services, got %#v", got)
+	}
+}
+
+func TestGetVisibleFrom(t *testing.T) {
+	exportTo := func(v string) echo.Annotations {
+		return echo.NewAnnotations().Set(echo.Annotation{Name: annotation.NetworkingExportTo.Name}, v)
+	}
+	public := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "public"}
+	everywhere := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "everywhere", ServiceAnnotations: exportTo("*")}
+	private := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "private", ServiceAnnotations: exportTo(".")}
+	shared := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "shared", ServiceAnnotations: exportTo("., echo2")}
+	hidden := &fakeInstance{Cluster: cls1, Namespace: echo1NS, Service: "hidden", ServiceAnnotations: exportTo("~")}
+	services := echo.Instances{public, everywhere, private, shared, hidden}.Services()
+
+	cases := []struct {
+		namespace string
+		want      []string
+	}{
+		{"echo1", []string{
+			"everywhere.echo1.svc.cluster.local",
+			"private.echo1.svc.cluster.local",
+			"public.echo1.svc.cluster.local",
+			"shared.echo1.svc.cluster.local",
+		}},
+		{"echo2", []string{
+			"everywhere.echo1.svc.cluster.local",
+			"public.echo1.svc.cluster.local",
+			"shared.echo1.svc.cluster.local",
+		}},
+		{"echo3", []string{
+			"everywhere.echo1.svc.cluster.local",
+			"public.echo1.svc.cluster.local",
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.namespace, func(t *testing.T) {
+			if diff := cmp.Diff(services.GetVisibleFrom(tc.namespace).FQDNs(), tc.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestGetByClusterAndNamespace(t *testing.T) {
+	services := all.Services()
+	got := services.GetByClusterAndNamespace("cls2", "echo1")
+	if diff := cmp.Diff(got.FQDNs(), []string{"a.echo1.svc.cluster.local", "c.echo1.svc.cluster.local"}); diff != "" {
+		t.Fatal(diff)
+	}
+	if a := got.GetByFQDN("a.echo1.svc.cluster.local"); len(a.Instances()) != 1 || a.Instances()[0] != a2 {
+		t.Fatalf("expected only the cls2 instance of a, got %v", a.Instances())
+	}
+	if got := services.GetByClusterAndNamespace("cls2", "echo2"); got == nil || len(got) != 0 {
+		t.Fatalf("expected empty non-nil Services, got %#v", got)
+	}
+}
+
+func TestForEachCluster(t *testing.T) {
+	services := all.Services()
+	var visited []cluster.ID
+	err := services.ForEachCluster(func(c cluster.ID, s echo.Services) error {
+		visited = append(visited, c)
+		if diff := cmp.Diff(s.FQDNs(), services.ForCluster(c).FQDNs()); diff != "" {
+			t.Fatalf("cluster %s: %s", c, diff)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(visited, []cluster.ID{"cls1", "cls2"}); diff != "" {
+		t.Fatal(diff)
+	}
+
+	visited = nil
+	stop := errors.New("stop")
+	err = services.ForEachCluster(func(c cluster.ID, _ echo.Services) error {
+		visited = append(visited, c)
+		return stop
+	})
+	if err != stop || len(visited) != 1 {
+		t.Fatalf("expected iteration to stop after the first error, got %v after visiting %v", err, visited)
+	}
+}
+
+var _ echo.Instance = fakeInstance{}
+
+// fakeInstance wraps echo.Config for test-framework internals tests where we don't actually make calls
+type fakeInstance echo.Config
+
+func (f fakeInstance) Instances() echo.Instances {
+	return echo.Instances{f}
+}
+
+func (f fakeInstance) ID() resource.ID {
+	panic("implement me")
+}
+
+func (f fakeInstance) NamespacedName() model.NamespacedName {
+	return f.Config().NamespacedName()
+}
+
+func (f fakeInstance) PortForName(name string) echo.Port {
+	return f.Config().Ports.MustForName(name)
+}
+
+func (f fakeInstance) Config() echo.Config {
+	cfg := echo.Config(f)
+	_ = cfg.FillDefaults(nil)
+	return cfg
+}
+
+func (f fakeInstance) Address() string {
+	panic("implement me")
+}
+
+func (f fakeInstance) Addresses() []string {
+	panic("implement me")
+}
+
+func (f fakeInstance) Workloads() (echo.Workloads, error) {
+	panic("implement me")
+}
+
+func (f fakeInstance) WorkloadsOrFail(test.Failer) echo.Workloads {
+	panic("implement me")
+}
+
+func (f fakeInstance) MustWorkloads() echo.Workloads {
+	panic("implement me")
+}
+
+func (f fakeInstance) Clusters() fwcluster.Clusters {
+	panic("implement me")
+}
+
+func (f fakeInstance) Call(echo.CallOptions) (echoClient.Responses, error) {
+	panic("implement me")
+}
+
+func (f fakeInstance) CallOrFail(test.Failer, echo.CallOptions) echoClient.Responses {
+	panic("implement me")
+}
+
+func (f fakeInstance) Restart() error {
+	panic("implement me")
+}
+
+func (f fakeInstance) ExecCommand(context.Context, string, ...string) (string, string, error) {
+	panic("implement me")
+}
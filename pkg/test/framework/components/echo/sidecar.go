@@ -32,6 +32,10 @@ type Sidecar interface {
 	Config() (*envoyAdmin.ConfigDump, error)
 	ConfigOrFail(t test.Failer) *envoyAdmin.ConfigDump
 
+	// ResourceConfig of the Envoy instance, limited to the given config dump resource (e.g. dynamic_listeners or
+	// dynamic_active_clusters). This avoids fetching the full config dump when only one section is needed.
+	ResourceConfig(resource string) (*envoyAdmin.ConfigDump, error)
+
 	// WaitForConfig queries the Envoy configuration an executes the given accept handler. If the
 	// response is not accepted, the request will be retried until either a timeout or a response
 	// has been accepted.
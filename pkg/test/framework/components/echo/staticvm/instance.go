@@ -181,3 +181,7 @@ func (i *instance) CallOrFail(t test.Failer, opts echo.CallOptions) echoClient.R
 func (i *instance) Restart() error {
 	panic("cannot trigger restart of a static VM")
 }
+
+func (i *instance) ExecCommand(context.Context, string, ...string) (string, string, error) {
+	return "", "", errors.New("cannot exec commands on a static VM")
+}
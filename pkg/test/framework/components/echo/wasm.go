@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	envoyAdmin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	wasmfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+)
+
+const (
+	// WasmExtensionLoaded indicates the Wasm filter config, including the module, is part of the listener config.
+	WasmExtensionLoaded = "Loaded"
+	// WasmExtensionDiscovered indicates the Wasm filter config is delivered separately through extension config
+	// discovery (ECDS), so its module is not visible in the listener config.
+	WasmExtensionDiscovered = "Discovered"
+)
+
+// WasmExtensionStatus describes a Wasm HTTP filter configured in a proxy.
+type WasmExtensionStatus struct {
+	// Name of the plugin, or of the filter for discovered extensions.
+	Name string
+	// State of the extension: WasmExtensionLoaded or WasmExtensionDiscovered.
+	State string
+	// PluginURL is the location of the module: a URL for remote modules, or the file name (or inline
+	// string, for null VM plugins) of local modules. Empty for discovered extensions.
+	PluginURL string
+}
+
+const wasmTypeURL = "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm"
+
+// wasmExtensions returns the Wasm HTTP filters in the listeners of the config dump, deduplicated by name.
+func wasmExtensions(dump *envoyAdmin.ConfigDump) ([]WasmExtensionStatus, error) {
+	var out []WasmExtensionStatus
+	seen := map[string]bool{}
+	add := func(s WasmExtensionStatus) {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			out = append(out, s)
+		}
+	}
+	for _, c := range dump.Configs {
+		listeners := &envoyAdmin.ListenersConfigDump{}
+		if !c.MessageIs(listeners) {
+			continue
+		}
+		if err := c.UnmarshalTo(listeners); err != nil {
+			return nil, err
+		}
+		for _, dl := range listeners.DynamicListeners {
+			if dl.GetActiveState().GetListener() == nil {
+				continue
+			}
+			l := &listener.Listener{}
+			if err := dl.ActiveState.Listener.UnmarshalTo(l); err != nil {
+				return nil, err
+			}
+			for _, fc := range l.FilterChains {
+				for _, f := range fc.Filters {
+					if f.Name != wellknown.HTTPConnectionManager || f.GetTypedConfig() == nil {
+						continue
+					}
+					h := &hcm.HttpConnectionManager{}
+					if err := f.GetTypedConfig().UnmarshalTo(h); err != nil {
+						return nil, err
+					}
+					for _, hf := range h.HttpFilters {
+						if cd := hf.GetConfigDiscovery(); cd != nil {
+							for _, t := range cd.TypeUrls {
+								if t == wasmTypeURL {
+									add(WasmExtensionStatus{Name: hf.Name, State: WasmExtensionDiscovered})
+								}
+							}
+							continue
+						}
+						if hf.GetTypedConfig().GetTypeUrl() != wasmTypeURL {
+							continue
+						}
+						w := &wasmfilter.Wasm{}
+						if err := hf.GetTypedConfig().UnmarshalTo(w); err != nil {
+							return nil, err
+						}
+						name := w.GetConfig().GetName()
+						if name == "" {
+							name = hf.Name
+						}
+						code := w.GetConfig().GetVmConfig().GetCode()
+						url := code.GetRemote().GetHttpUri().GetUri()
+						if url == "" {
+							url = code.GetLocal().GetFilename()
+						}
+						if url == "" {
+							url = code.GetLocal().GetInlineString()
+						}
+						add(WasmExtensionStatus{Name: name, State: WasmExtensionLoaded, PluginURL: url})
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
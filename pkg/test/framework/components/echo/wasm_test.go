@@ -0,0 +1,75 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+
+	envoyAdmin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	wasmfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/wasm/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestWasmExtensions(t *testing.T) {
+	remote := &wasmfilter.Wasm{Config: &wasm.PluginConfig{
+		Name: "ns.plugin",
+		Vm: &wasm.PluginConfig_VmConfig{VmConfig: &wasm.VmConfig{Code: &core.AsyncDataSource{Specifier: &core.AsyncDataSource_Remote{
+			Remote: &core.RemoteDataSource{HttpUri: &core.HttpUri{Uri: "https://example.com/plugin.wasm"}},
+		}}}},
+	}}
+	manager := &hcm.HttpConnectionManager{HttpFilters: []*hcm.HttpFilter{
+		{Name: "remote", ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: toAny(t, remote)}},
+		{Name: "ns.discovered", ConfigType: &hcm.HttpFilter_ConfigDiscovery{ConfigDiscovery: &core.ExtensionConfigSource{
+			TypeUrls: []string{wasmTypeURL},
+		}}},
+		{Name: "envoy.filters.http.router"},
+	}}
+	l := &listener.Listener{FilterChains: []*listener.FilterChain{{Filters: []*listener.Filter{{
+		Name:       wellknown.HTTPConnectionManager,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: toAny(t, manager)},
+	}}}}}
+	dump := &envoyAdmin.ConfigDump{Configs: []*anypb.Any{toAny(t, &envoyAdmin.ListenersConfigDump{
+		DynamicListeners: []*envoyAdmin.ListenersConfigDump_DynamicListener{
+			{ActiveState: &envoyAdmin.ListenersConfigDump_DynamicListenerState{Listener: toAny(t, l)}},
+			{ActiveState: &envoyAdmin.ListenersConfigDump_DynamicListenerState{Listener: toAny(t, l)}},
+		},
+	})}}
+
+	got, err := wasmExtensions(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, []WasmExtensionStatus{
+		{Name: "ns.plugin", State: WasmExtensionLoaded, PluginURL: "https://example.com/plugin.wasm"},
+		{Name: "ns.discovered", State: WasmExtensionDiscovered},
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func toAny(t *testing.T, m proto.Message) *anypb.Any {
+	a, err := anypb.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
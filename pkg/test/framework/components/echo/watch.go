@@ -0,0 +1,275 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kubeCore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+// rewatchDelay is the time to wait before re-establishing a Kubernetes watch that failed.
+const rewatchDelay = time.Second
+
+// ServicesChangeEvent is a change in the availability of some of the Services, as sent by WatchForChanges.
+type ServicesChangeEvent struct {
+	// Added are the services that now have ready endpoints in at least one cluster.
+	Added Services
+	// Removed are the services that no longer have ready endpoints in any cluster.
+	Removed Services
+}
+
+// endpointsUpdate is the readiness of the endpoints of a service in a single cluster.
+type endpointsUpdate struct {
+	fqdn    string
+	cluster string
+	ready   bool
+}
+
+// WatchForChanges watches the Kubernetes Endpoints of the Services in every cluster they are deployed to, and sends
+// an event whenever a service becomes available (it has a ready endpoint in at least one cluster) or unavailable (it
+// has none left). Only changes after the call are reported. The returned channel is closed once ctx is done.
+func (d Services) WatchForChanges(ctx context.Context) (<-chan ServicesChangeEvent, error) {
+	type watchKey struct {
+		cluster   string
+		namespace string
+	}
+	clusters := map[watchKey]cluster.Cluster{}
+	// The services in each namespace of each cluster, keyed by name.
+	watched := map[watchKey]map[string]Instances{}
+	for _, target := range d.deployed() {
+		for _, instance := range target {
+			cfg := instance.Config()
+			k := watchKey{cluster: cfg.Cluster.Name(), namespace: cfg.Namespace.Name()}
+			if watched[k] == nil {
+				watched[k] = map[string]Instances{}
+				clusters[k] = cfg.Cluster
+			}
+			watched[k][cfg.Service] = target
+		}
+	}
+
+	// available tracks which clusters each service has ready endpoints in.
+	available := map[string]map[string]bool{}
+	type endpointsWatch struct {
+		watchKey
+		w  watch.Interface
+		rv string
+	}
+	// Set up every watch before starting any goroutines, so that nothing is left running if one fails.
+	var watches []endpointsWatch
+	stopAll := func() {
+		for _, ew := range watches {
+			ew.w.Stop()
+		}
+	}
+	for k, services := range watched {
+		state, rv, err := listEndpoints(ctx, clusters[k], k.namespace, services)
+		if err != nil {
+			stopAll()
+			return nil, err
+		}
+		for _, u := range state {
+			if available[u.fqdn] == nil {
+				available[u.fqdn] = map[string]bool{}
+			}
+			available[u.fqdn][u.cluster] = u.ready
+		}
+		// Start watching before returning, so that no change made after the call is missed.
+		w, err := clusters[k].CoreV1().Endpoints(k.namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: rv})
+		if err != nil {
+			stopAll()
+			return nil, fmt.Errorf("failed watching endpoints in %s in cluster %s: %v", k.namespace, clusters[k].Name(), err)
+		}
+		watches = append(watches, endpointsWatch{watchKey: k, w: w, rv: rv})
+	}
+	updates := make(chan endpointsUpdate)
+	for _, ew := range watches {
+		go watchEndpoints(ctx, clusters[ew.watchKey], ew.namespace, watched[ew.watchKey], ew.w, ew.rv, updates)
+	}
+
+	byFQDN := map[string]Instances{}
+	for _, target := range d {
+		byFQDN[target.Config().ClusterLocalFQDN()] = target
+	}
+	isAvailable := func(fqdn string) bool {
+		for _, ready := range available[fqdn] {
+			if ready {
+				return true
+			}
+		}
+		return false
+	}
+
+	out := make(chan ServicesChangeEvent)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case u := <-updates:
+				was := isAvailable(u.fqdn)
+				if available[u.fqdn] == nil {
+					available[u.fqdn] = map[string]bool{}
+				}
+				available[u.fqdn][u.cluster] = u.ready
+				now := isAvailable(u.fqdn)
+				if was == now {
+					continue
+				}
+				event := ServicesChangeEvent{}
+				if now {
+					event.Added = Services{byFQDN[u.fqdn]}
+				} else {
+					event.Removed = Services{byFQDN[u.fqdn]}
+				}
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// listEndpoints returns the readiness of each of the given services in the namespace of the cluster, along with the
+// resource version to start watching from.
+func listEndpoints(ctx context.Context, c cluster.Cluster, namespace string,
+	services map[string]Instances) ([]endpointsUpdate, string, error) {
+	list, err := c.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed listing endpoints in %s in cluster %s: %v", namespace, c.Name(), err)
+	}
+	ready := map[string]bool{}
+	for i := range list.Items {
+		ready[list.Items[i].Name] = hasReadyAddress(&list.Items[i])
+	}
+	out := make([]endpointsUpdate, 0, len(services))
+	for name, target := range services {
+		out = append(out, endpointsUpdate{
+			fqdn:    target.Config().ClusterLocalFQDN(),
+			cluster: c.Name(),
+			ready:   ready[name],
+		})
+	}
+	return out, list.ResourceVersion, nil
+}
+
+// watchEndpoints sends an update for each event of the watch w on the Endpoints of the given services in the
+// namespace of the cluster, until ctx is done. If the watch is closed by the server, it is re-established, listing
+// the endpoints again first if needed.
+func watchEndpoints(ctx context.Context, c cluster.Cluster, namespace string, services map[string]Instances,
+	w watch.Interface, rv string, updates chan<- endpointsUpdate) {
+	send := func(u endpointsUpdate) bool {
+		select {
+		case updates <- u:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		rv = consumeEndpointsWatch(ctx, w, rv, c.Name(), services, send)
+		w.Stop()
+		for {
+			if rv == "" {
+				// The watch failed or expired, so re-list to catch up on any changes that were missed.
+				select {
+				case <-time.After(rewatchDelay):
+				case <-ctx.Done():
+					return
+				}
+				state, listRV, err := listEndpoints(ctx, c, namespace, services)
+				if err != nil {
+					scopes.Framework.Warnf("%v", err)
+					continue
+				}
+				for _, u := range state {
+					if !send(u) {
+						return
+					}
+				}
+				rv = listRV
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			var err error
+			if w, err = c.CoreV1().Endpoints(namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: rv}); err == nil {
+				break
+			}
+			scopes.Framework.Warnf("failed watching endpoints in %s in cluster %s: %v", namespace, c.Name(), err)
+			rv = ""
+		}
+	}
+}
+
+// consumeEndpointsWatch sends an update for each event of the watch that concerns one of the given services, until
+// the watch is closed, ctx is done or sending fails. It returns the resource version to resume watching from,
+// starting at rv, or an empty string if the watch must be re-established from a fresh list.
+func consumeEndpointsWatch(ctx context.Context, w watch.Interface, rv string, clusterName string,
+	services map[string]Instances, send func(endpointsUpdate) bool) string {
+	for {
+		var e watch.Event
+		var ok bool
+		select {
+		case e, ok = <-w.ResultChan():
+			if !ok {
+				return rv
+			}
+		case <-ctx.Done():
+			return rv
+		}
+		if e.Type == watch.Error {
+			return ""
+		}
+		ep, ok := e.Object.(*kubeCore.Endpoints)
+		if !ok {
+			continue
+		}
+		rv = ep.ResourceVersion
+		target, f := services[ep.Name]
+		if !f {
+			continue
+		}
+		u := endpointsUpdate{
+			fqdn:    target.Config().ClusterLocalFQDN(),
+			cluster: clusterName,
+			ready:   e.Type != watch.Deleted && hasReadyAddress(ep),
+		}
+		if !send(u) {
+			return rv
+		}
+	}
+}
+
+func hasReadyAddress(ep *kubeCore.Endpoints) bool {
+	for _, subset := range ep.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kubeCore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"istio.io/istio/pkg/kube"
+	fwcluster "istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+func TestWatchForChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &fwcluster.FakeCluster{
+		ExtendedClient: kube.NewFakeClient(),
+		Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+	}
+	a := &fakeInstance{Cluster: c, Namespace: echo1NS, Service: "a"}
+	events, err := echo.Instances{a}.Services().WatchForChanges(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(added, removed []string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if len(e.Added.FQDNs()) != len(added) || len(e.Removed.FQDNs()) != len(removed) ||
+				(len(added) > 0 && e.Added.FQDNs()[0] != added[0]) ||
+				(len(removed) > 0 && e.Removed.FQDNs()[0] != removed[0]) {
+				t.Fatalf("expected added %v and removed %v, got added %v and removed %v",
+					added, removed, e.Added.FQDNs(), e.Removed.FQDNs())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for added %v and removed %v", added, removed)
+		}
+	}
+
+	endpoints := c.CoreV1().Endpoints(echo1NS.Name())
+	ep := &kubeCore.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: echo1NS.Name()},
+		Subsets: []kubeCore.EndpointSubset{{
+			Addresses: []kubeCore.EndpointAddress{{IP: "10.0.0.1"}},
+		}},
+	}
+	// Endpoints for other services are ignored.
+	other := ep.DeepCopy()
+	other.Name = "b"
+	if _, err := endpoints.Create(ctx, other, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := endpoints.Create(ctx, ep, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect([]string{"a.echo1.svc.cluster.local"}, nil)
+
+	if err := endpoints.Delete(ctx, "a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(nil, []string{"a.echo1.svc.cluster.local"})
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchForChangesSetupError(t *testing.T) {
+	// The namespaces are set up in map order, so repeat to cover the failing one coming both first and last.
+	for i := 0; i < 10; i++ {
+		client := kube.NewFakeClient()
+		cs := client.Kube().(*fake.Clientset)
+		var mu sync.Mutex
+		var watchers []*watch.FakeWatcher
+		cs.PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			w := watch.NewFake()
+			watchers = append(watchers, w)
+			return true, w, nil
+		})
+		cs.PrependReactor("list", "endpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetNamespace() == echo2NS.Name() {
+				return true, nil, errors.New("injected list error")
+			}
+			return false, nil, nil
+		})
+		c := &fwcluster.FakeCluster{
+			ExtendedClient: client,
+			Topology:       fwcluster.Topology{ClusterName: "cls1", Network: "n1", ClusterKind: fwcluster.Fake},
+		}
+		services := echo.Instances{
+			&fakeInstance{Cluster: c, Namespace: echo1NS, Service: "a"},
+			&fakeInstance{Cluster: c, Namespace: echo2NS, Service: "a"},
+		}.Services()
+		if _, err := services.WatchForChanges(context.Background()); err == nil {
+			t.Fatal("expected an error listing endpoints")
+		}
+		mu.Lock()
+		for _, w := range watchers {
+			if !w.IsStopped() {
+				t.Fatal("watch was left running after WatchForChanges failed")
+			}
+		}
+		mu.Unlock()
+	}
+}
@@ -178,15 +178,20 @@ func (n *kubeNamespace) removeNamespaceLabel(key string) error {
 	return nil
 }
 
-// NewNamespace allocates a new testing namespace.
-func newKube(ctx resource.Context, nsConfig *Config) (Instance, error) {
+// generateName returns a new, unique name for a namespace with the given prefix.
+func generateName(prefix string) string {
 	mu.Lock()
 	idctr++
 	nsid := idctr
 	r := rnd.Intn(99999)
 	mu.Unlock()
 
-	ns := fmt.Sprintf("%s-%d-%d", nsConfig.Prefix, nsid, r)
+	return fmt.Sprintf("%s-%d-%d", prefix, nsid, r)
+}
+
+// NewNamespace allocates a new testing namespace.
+func newKube(ctx resource.Context, nsConfig *Config) (Instance, error) {
+	ns := generateName(nsConfig.Prefix)
 	n := &kubeNamespace{
 		name:   ns,
 		prefix: nsConfig.Prefix,
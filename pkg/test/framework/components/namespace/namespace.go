@@ -33,9 +33,14 @@ type Config struct {
 
 // Instance represents an allocated namespace that can be used to create config, or deploy components in.
 type Instance interface {
+	// Name is the full name of the namespace.
 	Name() string
 	SetLabel(key, value string) error
 	RemoveLabel(key string) error
+	// Prefix is the Config.Prefix the namespace was allocated with. Namespaces created by New are named
+	// "<prefix>-<n>-<random>", where n counts the namespaces allocated by this test binary and random is a
+	// number below 99999, so the prefix stays the same across runs while the name does not. For claimed and
+	// static namespaces, the prefix is the same as the name.
 	Prefix() string
 	Labels() (map[string]string, error)
 }
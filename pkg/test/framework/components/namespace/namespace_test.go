@@ -15,6 +15,8 @@
 package namespace
 
 import (
+	"regexp"
+	"strconv"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -68,3 +70,46 @@ func TestConfigRevisionOverwrite(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateName(t *testing.T) {
+	g := NewWithT(t)
+	re := regexp.MustCompile(`^(.*)-(\d+)-(\d+)$`)
+	var lastID int
+	for i, prefix := range []string{"echo", "echo-1", "echo"} {
+		name := generateName(prefix)
+		m := re.FindStringSubmatch(name)
+		g.Expect(m).To(HaveLen(4), "unexpected name %q", name)
+		g.Expect(m[1]).To(Equal(prefix))
+
+		id, err := strconv.Atoi(m[2])
+		g.Expect(err).NotTo(HaveOccurred())
+		if i > 0 {
+			g.Expect(id).To(Equal(lastID+1), "expected names to count the allocated namespaces")
+		}
+		lastID = id
+
+		r, err := strconv.Atoi(m[3])
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(r).To(BeNumerically("<", 99999))
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	name := generateName("echo")
+	cases := []struct {
+		name     string
+		instance Instance
+		wantName string
+	}{
+		{"generated", &kubeNamespace{name: name, prefix: "echo"}, name},
+		{"claimed", &kubeNamespace{name: "echo", prefix: "echo"}, "echo"},
+		{"static", Static("echo"), "echo"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tc.instance.Name()).To(Equal(tc.wantName))
+			g.Expect(tc.instance.Prefix()).To(Equal("echo"), "prefix of %q", tc.instance.Name())
+		})
+	}
+}
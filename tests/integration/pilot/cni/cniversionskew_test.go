@@ -84,7 +84,7 @@ func TestCNIVersionSkew(t *testing.T) {
 				if _, err := kube.WaitUntilPodsAreReady(podFetchFn); err != nil {
 					t.Fatal(err)
 				}
-				if err := apps.All.Instances().Restart(); err != nil {
+				if err := apps.All.AllInstances().Restart(); err != nil {
 					t.Fatalf("Failed to restart apps %v", err)
 				}
 				common.RunAllTrafficTests(t, i, &apps)
@@ -725,7 +725,7 @@ spec:
 								return fmt.Errorf("expected %v calls to %s, got %v", exp, serviceName, len(hostResponses))
 							}
 							// echotest should have filtered the deployment to only contain reachable clusters
-							to := match.ServiceName(serviceName).GetMatches(dests.Instances())
+							to := match.ServiceName(serviceName).GetMatches(dests.AllInstances())
 							toClusters := to.Clusters()
 							// don't check headless since lb is unpredictable
 							headlessTarget := match.Headless.Any(to)
@@ -2825,7 +2825,7 @@ func serverFirstTestCases(apps *deployment.SingleNamespaceView) []TrafficTestCas
 			cases = append(cases, TrafficTestCase{
 				name: fmt.Sprintf("%v:%v/%v", c.port, c.dest, c.auth),
 				skip: skip{
-					skip:   apps.All.Instances().Clusters().IsMulticluster(),
+					skip:   apps.All.AllInstances().Clusters().IsMulticluster(),
 					reason: "https://github.com/istio/istio/issues/37305: stabilize tcp connection breaks",
 				},
 				config: destinationRule(to.Config().Service, c.dest) + peerAuthentication(to.Config().Service, c.auth),
@@ -271,7 +271,7 @@ func RunAllTrafficTests(t framework.TestContext, i istio.Instance, apps *deploym
 		t.NewSubTest(name).Run(func(t framework.TestContext) {
 			for _, tt := range tts {
 				if tt.workloadAgnostic {
-					tt.RunForApps(t, apps.All.Instances(), apps.Namespace.Name())
+					tt.RunForApps(t, apps.All.AllInstances(), apps.Namespace.Name())
 				} else {
 					tt.Run(t, apps.Namespace.Name())
 				}